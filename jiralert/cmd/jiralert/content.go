@@ -1,11 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
+	"runtime"
 
 	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/config"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 )
 
 const (
@@ -71,20 +75,16 @@ type tdata struct {
 	Err error
 }
 
-var (
-	allTemplates   = template.Must(template.New("").Parse(templates))
-	homeTemplate   = pageTemplate("home")
-	configTemplate = pageTemplate("config")
-	// errorTemplate  = pageTemplate("error")
-)
-
+// pageTemplate parses the templates into the page with the given content. Done by the handler constructors, so HTML
+// templates aren't parsed at all with --web.disable-ui.
 func pageTemplate(name string) *template.Template {
 	pageTemplate := fmt.Sprintf(`{{define "content"}}{{template "content.%s" .}}{{end}}{{template "page" .}}`, name)
-	return template.Must(template.Must(allTemplates.Clone()).Parse(pageTemplate))
+	return template.Must(template.Must(template.New("").Parse(templates)).Parse(pageTemplate))
 }
 
 // HomeHandlerFunc is the HTTP handler for the home page (`/`).
 func HomeHandlerFunc() func(http.ResponseWriter, *http.Request) {
+	homeTemplate := pageTemplate("home")
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := homeTemplate.Execute(w, &tdata{
 			DocsUrl: docsUrl,
@@ -94,9 +94,16 @@ func HomeHandlerFunc() func(http.ResponseWriter, *http.Request) {
 	}
 }
 
-// ConfigHandlerFunc is the HTTP handler for the `/config` page. It outputs the configuration marshaled in YAML format.
-func ConfigHandlerFunc(config *config.Config) func(http.ResponseWriter, *http.Request) {
+// ConfigHandlerFunc is the HTTP handler for the `/config` page. It outputs the configuration marshaled in YAML format,
+// or as JSON when called with `?format=json`.
+func ConfigHandlerFunc(config *config.Config, logger log.Logger) func(http.ResponseWriter, *http.Request) {
+	configTemplate := pageTemplate("config")
+	configJSON := ConfigJSONHandlerFunc(config, logger)
 	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") == "json" {
+			configJSON(w, r)
+			return
+		}
 		if err := configTemplate.Execute(w, &tdata{
 			DocsUrl: docsUrl,
 			Config:  config.String(),
@@ -105,3 +112,33 @@ func ConfigHandlerFunc(config *config.Config) func(http.ResponseWriter, *http.Re
 		}
 	}
 }
+
+// ConfigJSONHandlerFunc is the HTTP handler for the `/config` page with --web.disable-ui. It only outputs the
+// configuration as JSON.
+func ConfigJSONHandlerFunc(config *config.Config, logger log.Logger) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b, err := config.JSON()
+		if err != nil {
+			level.Error(logger).Log("msg", "error marshaling configuration as JSON", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(b); err != nil {
+			level.Warn(logger).Log("msg", "error writing configuration", "err", err)
+		}
+	}
+}
+
+// VersionHandlerFunc is the HTTP handler for the `/version` page. It outputs the build metadata as JSON.
+func VersionHandlerFunc() func(http.ResponseWriter, *http.Request) {
+	b, _ := json.Marshal(struct {
+		Version   string `json:"version"`
+		GoVersion string `json:"goVersion"`
+		BuildDate string `json:"buildDate"`
+	}{Version, runtime.Version(), BuildDate})
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	}
+}
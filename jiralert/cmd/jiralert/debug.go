@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/config"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/notify"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/template"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// RenderHandlerFunc is the HTTP handler for `/-/render`. It renders the issue the receiver given in the `receiver`
+// query parameter would create for the Alertmanager payload in the request body, without contacting JIRA.
+func RenderHandlerFunc(config *config.Config, tmpl *template.Template, logger log.Logger) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		defer func() { _ = req.Body.Close() }()
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		data := alertmanager.Data{}
+		if err := json.NewDecoder(req.Body).Decode(&data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := req.URL.Query().Get("receiver")
+		if name == "" {
+			name = data.Receiver
+		}
+		conf, matches := config.ReceiverMatch(name)
+		if conf == nil {
+			http.Error(w, fmt.Sprintf("receiver missing: %s", name), http.StatusNotFound)
+			return
+		}
+		data.ReceiverMatches = matches
+
+		r, err := notify.NewReceiver(conf, tmpl.ForReceiver(conf.Name))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		issue, err := r.Render(&data, logger)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		response := struct {
+			Summary     string      `json:"summary"`
+			Description interface{} `json:"description"`
+			Labels      []string    `json:"labels"`
+		}{
+			Summary:     issue.Fields.Summary,
+			Description: issue.Fields.Description,
+			Labels:      issue.Fields.Labels,
+		}
+		if adf, ok := issue.Fields.Unknowns["description"]; ok {
+			response.Description = adf
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}
+}
+
+// LogLevelHandlerFunc is the HTTP handler for `/-/log-level`. GET returns the current log level, PUT replaces it with
+// the level in the request body (debug, info, warn or error).
+func LogLevelHandlerFunc(dynamic *dynamicLogger, logger log.Logger) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		defer func() { _ = req.Body.Close() }()
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			lvl := strings.TrimSpace(string(body))
+			if err := dynamic.SetLevel(lvl); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			level.Info(logger).Log("msg", "log level changed", "level", lvl)
+		default:
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fmt.Fprintln(w, dynamic.Level())
+	}
+}
+
+// recentAlert is an /alert payload, as kept for `/-/recent-alerts`.
+type recentAlert struct {
+	Received time.Time         `json:"received"`
+	Data     alertmanager.Data `json:"data"`
+}
+
+// recentAlerts is a ring buffer of the most recently received /alert payloads.
+type recentAlerts struct {
+	mu     sync.Mutex
+	buf    []recentAlert
+	next   int
+	redact map[string]bool
+}
+
+func newRecentAlerts(size int, redact []string) *recentAlerts {
+	if size < 0 {
+		size = 0
+	}
+	r := &recentAlerts{buf: make([]recentAlert, 0, size), redact: map[string]bool{}}
+	for _, name := range redact {
+		r.redact[name] = true
+	}
+	return r
+}
+
+// Add records a payload, replacing the oldest one if the buffer is full. Labels and annotations configured to be
+// redacted are masked.
+func (r *recentAlerts) Add(data alertmanager.Data) {
+	if cap(r.buf) == 0 {
+		return
+	}
+	data.GroupLabels = r.redactKV(data.GroupLabels)
+	data.CommonLabels = r.redactKV(data.CommonLabels)
+	data.CommonAnnotations = r.redactKV(data.CommonAnnotations)
+	alerts := make(alertmanager.Alerts, len(data.Alerts))
+	for i, a := range data.Alerts {
+		a.Labels = r.redactKV(a.Labels)
+		a.Annotations = r.redactKV(a.Annotations)
+		alerts[i] = a
+	}
+	data.Alerts = alerts
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry := recentAlert{Received: time.Now(), Data: data}
+	if len(r.buf) < cap(r.buf) {
+		r.buf = append(r.buf, entry)
+		return
+	}
+	r.buf[r.next] = entry
+	r.next = (r.next + 1) % len(r.buf)
+}
+
+// List returns the recorded payloads, most recent first.
+func (r *recentAlerts) List() []recentAlert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]recentAlert, 0, len(r.buf))
+	for i := 0; i < len(r.buf); i++ {
+		res = append(res, r.buf[(r.next+len(r.buf)-1-i)%len(r.buf)])
+	}
+	return res
+}
+
+func (r *recentAlerts) redactKV(kv alertmanager.KV) alertmanager.KV {
+	if len(r.redact) == 0 {
+		return kv
+	}
+	res := make(alertmanager.KV, len(kv))
+	for k, v := range kv {
+		if r.redact[k] {
+			v = "<redacted>"
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// RecentAlertsHandlerFunc is the HTTP handler for `/-/recent-alerts`. It outputs the most recently received /alert
+// payloads as JSON, most recent first.
+func RecentAlertsHandlerFunc(recent *recentAlerts) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(recent.List())
+	}
+}
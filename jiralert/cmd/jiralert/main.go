@@ -1,13 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	texttemplate "text/template"
+	"time"
 
 	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
 	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/config"
@@ -18,6 +28,7 @@ import (
 
 	_ "net/http/pprof"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -28,13 +39,45 @@ const (
 )
 
 var (
-	listenAddress = flag.String("listen-address", ":9097", "The address to listen on for HTTP requests.")
-	configFile    = flag.String("config", "config/jiralert.yml", "The JIRAlert configuration file")
-	logLevel      = flag.String("log.level", "info", "Log filtering level (debug, info, warn, error)")
-	logFormat     = flag.String("log.format", logFormatLogfmt, "Log format to use ("+logFormatLogfmt+", "+logFormatJson+")")
+	listenAddress  = flag.String("listen-address", ":9097", "The address to listen on for HTTP requests.")
+	configFile     = flag.String("config", "config/jiralert.yml", "The JIRAlert configuration file")
+	logLevel       = flag.String("log.level", "info", "Log filtering level (debug, info, warn, error). Overrides the LOG_LEVEL environment variable")
+	logFormat      = flag.String("log.format", logFormatLogfmt, "Log format to use ("+logFormatLogfmt+", "+logFormatJson+")")
+	hmacSecretFile = flag.String("web.hmac-secret-file", "", "File containing the shared secret used to verify the X-Signature header (hex encoded HMAC-SHA256 of the body) of /alert requests. Verification is disabled if empty")
+	enableDebug    = flag.Bool("web.enable-debug-endpoints", false, "Enable the /-/ debugging endpoints, such as /-/render")
+	jiraUserAgent  = flag.String("jira-user-agent", "", "User-Agent header sent with JIRA requests (default \"JIRAlert/<version>\")")
+	jiraClientCert = flag.String("jira-client-cert-file", "", "TLS client certificate (PEM) presented to JIRA, for mutual TLS. Receivers may override it with jira_client_cert_file")
+	jiraClientKey  = flag.String("jira-client-key-file", "", "Private key (PEM) of --jira-client-cert-file")
+	jiraConcurrent = flag.Int("jira-concurrency", 0, "Maximum number of notifications handled concurrently per JIRA instance, unless set for the instance in jira_concurrency. No limit if 0")
+	jiraTimeout    = flag.Duration("jira-timeout", 0, "Maximum duration of a notification, including all of its JIRA requests, for receivers without a timeout of their own. Timed out notifications are reported as retryable. No timeout if 0")
+	failOnMissing  = flag.Bool("template.fail-on-missing", false, "Exit at startup if any receiver references an undefined template")
+	recentSize     = flag.Int("web.recent-alerts", 20, "Number of recent /alert payloads kept for /-/recent-alerts, when debugging endpoints are enabled")
+	recentRedact   = flag.String("web.recent-alerts.redact", "", "Comma separated label and annotation names whose values are masked in /-/recent-alerts")
+	requireAuth    = flag.Bool("require-jira-auth", false, "Exit at startup if any receiver fails to authenticate to JIRA")
+	validateJQL    = flag.Bool("validate-jql", false, "Exit at startup if the precondition_jql of any receiver, rendered without alert data, is invalid. Requires JIRA to be reachable")
+	retryAfter     = flag.Duration("web.retry-after", 0, "Retry-After sent with 503 Service Unavailable responses to retryable errors, hinting Alertmanager to back off (rounded up to whole seconds). Not sent if 0")
+	trustedProxy   = flag.String("web.trusted-proxies", "", "Comma separated CIDRs of proxies whose X-Forwarded-For and X-Real-IP headers are trusted for logging the client address")
+	alertMethods   = flag.String("alert.methods", http.MethodPost, "Comma separated HTTP methods accepted by /alert. Requests using other methods are rejected with 405 Method Not Allowed")
+	strictDecode   = flag.Bool("alert.strict-decode", false, "Reject /alert payloads with fields unknown to JIRAlert with 400 Bad Request, to catch integration bugs. Unknown fields are ignored by default")
+	metricNS       = flag.String("metric-namespace", defaultNamespace, "Prefix of the names of JIRAlert's own metrics, e.g. \"tenant_a_jiralert\" to tell apart instances scraped into one registry")
+	accessLog      = flag.Bool("web.access-log", false, "Log every HTTP request once handled, with method, path, status, duration and client, at info level")
+	successBody    = flag.String("alert.success-template", "", "Go template of the body of successful synchronous /alert responses, executed with .Receiver, .IssueKey and .IssueURL. By default, these are returned as JSON")
+	disableUI      = flag.Bool("web.disable-ui", false, "Don't serve the HTML pages. /config only serves the configuration as JSON")
+	async          = flag.Bool("async", false, "Respond to /alert right away and create issues in the background. Delivery becomes best effort: failed notifications are only retried when Alertmanager resends the alert group")
+	asyncQueueSize = flag.Int("async.queue-size", 100, "Maximum number of notifications waiting to be processed in --async mode. Requests exceeding it are rejected with 503")
+	asyncWorkers   = flag.Int("async.workers", 4, "Number of notifications processed concurrently in --async mode")
+	auditLogFile   = flag.String("audit-log-file", "", "File to append a JSON line to for every issue created, updated, reopened or resolved, or \"-\" for stdout. Disabled if empty")
+	auditFsync     = flag.Bool("audit-log-fsync", false, "Sync --audit-log-file to disk after every record, so no record is lost if JIRAlert or its host crashes")
+	lockRedis      = flag.String("lock.redis-address", "", "Redis server (host:port) holding locks that keep JIRAlert replicas from handling the same alert group concurrently. Disabled if empty, which suits a single replica")
+	lockRedisPass  = flag.String("lock.redis-password-file", "", "File containing the password of the --lock.redis-address server")
+	lockTTL        = flag.Duration("lock.ttl", time.Minute, "Time after which a lock held by a replica expires, in case the replica died while holding it")
+	dedupCacheSize = flag.Int("dedup-cache-size", 1000, "Maximum number of alert groups remembered as recently created, for dedup_grace. The least recently used are evicted first")
+	dedupCacheTTL  = flag.Duration("dedup-cache-ttl", time.Hour, "Time after which an alert group is no longer remembered as recently created. Should exceed the longest dedup_grace")
 
 	// Version is the build version, set by make to latest git tag/hash via `-ldflags "-X main.Version=$(VERSION)"`.
 	Version = "<local build>"
+	// BuildDate is the build time, set via `-ldflags "-X main.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"`. Empty if not set.
+	BuildDate = ""
 )
 
 func main() {
@@ -45,124 +88,466 @@ func main() {
 
 	flag.Parse()
 
-	var logger = setupLogger(*logLevel, *logFormat)
+	// LOG_LEVEL is an alternative to --log.level, which takes precedence if given.
+	lvl := *logLevel
+	if env := os.Getenv("LOG_LEVEL"); env != "" {
+		lvl = env
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "log.level" {
+				lvl = *logLevel
+			}
+		})
+	}
+	var logger, dynamic = setupLogger(lvl, *logFormat)
 	level.Info(logger).Log("msg", "starting JIRAlert", "version", Version)
 
+	notify.UserAgent = "JIRAlert/" + Version
+	if *jiraUserAgent != "" {
+		notify.UserAgent = *jiraUserAgent
+	}
+	notify.Timeout = *jiraTimeout
+	switch *auditLogFile {
+	case "":
+	case "-":
+		notify.AuditLog = notify.NewAuditWriter(os.Stdout, *auditFsync)
+	default:
+		f, err := os.OpenFile(*auditLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			level.Error(logger).Log("msg", "error opening audit log", "path", *auditLogFile, "err", err)
+			os.Exit(1)
+		}
+		notify.AuditLog = notify.NewAuditWriter(f, *auditFsync)
+	}
+	if !metricNamespaceRE.MatchString(*metricNS) {
+		level.Error(logger).Log("msg", "invalid --metric-namespace, must be a valid Prometheus metric name", "namespace", *metricNS)
+		os.Exit(1)
+	}
+	if *dedupCacheSize <= 0 || *dedupCacheTTL <= 0 {
+		level.Error(logger).Log("msg", "--dedup-cache-size and --dedup-cache-ttl must be positive", "size", *dedupCacheSize, "ttl", *dedupCacheTTL)
+		os.Exit(1)
+	}
+	if (*jiraClientCert == "") != (*jiraClientKey == "") {
+		level.Error(logger).Log("msg", "--jira-client-cert-file and --jira-client-key-file must be set together")
+		os.Exit(1)
+	}
+	if *jiraClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(*jiraClientCert, *jiraClientKey)
+		if err != nil {
+			level.Error(logger).Log("msg", "error loading JIRA client certificate", "path", *jiraClientCert, "err", err)
+			os.Exit(1)
+		}
+		notify.ClientCertificate = &cert
+	}
+
 	config, _, err := config.LoadFile(*configFile, logger)
 	if err != nil {
 		level.Error(logger).Log("msg", "error loading configuration", "path", *configFile, "err", err)
 		os.Exit(1)
 	}
 
-	tmpl, err := template.LoadTemplate(config.Template, logger)
+	notify.ConfigureConcurrency(*jiraConcurrent, config.JiraConcurrency)
+
+	tmpl, err := template.LoadTemplate(config.Template, config.TemplateFiles(), config.TemplateDelims(), logger)
 	if err != nil {
 		level.Error(logger).Log("msg", "error loading templates", "path", config.Template, "err", err)
 		os.Exit(1)
 	}
 
+	for _, rc := range config.Receivers {
+		if rc.JiraClientCertFile == "" {
+			continue
+		}
+		if _, err := tls.LoadX509KeyPair(rc.JiraClientCertFile, rc.JiraClientKeyFile); err != nil {
+			level.Error(logger).Log("msg", "error loading JIRA client certificate", "receiver", rc.Name, "path", rc.JiraClientCertFile, "err", err)
+			os.Exit(1)
+		}
+	}
+
+	missing := false
+	for _, rc := range config.Receivers {
+		if names := tmpl.ForReceiver(rc.Name).MissingTemplates(rc.Templates()); len(names) > 0 {
+			level.Error(logger).Log("msg", "receiver references undefined templates", "receiver", rc.Name, "templates", strings.Join(names, ", "))
+			missing = true
+		}
+	}
+	if missing && *failOnMissing {
+		os.Exit(1)
+	}
+
+	var hmacSecret []byte
+	if *hmacSecretFile != "" {
+		secret, err := ioutil.ReadFile(*hmacSecretFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "error reading HMAC secret", "path", *hmacSecretFile, "err", err)
+			os.Exit(1)
+		}
+		hmacSecret = bytes.TrimSpace(secret)
+	}
+
+	notify.ConfigureDedupCache(*dedupCacheSize, *dedupCacheTTL)
+
+	if *lockRedis != "" {
+		var password []byte
+		if *lockRedisPass != "" {
+			if password, err = ioutil.ReadFile(*lockRedisPass); err != nil {
+				level.Error(logger).Log("msg", "error reading Redis password", "path", *lockRedisPass, "err", err)
+				os.Exit(1)
+			}
+		}
+		notify.ReplicaLock = notify.NewRedisLocker(*lockRedis, string(bytes.TrimSpace(password)), *lockTTL)
+	}
+
+	if err := checkJiraAuth(config, tmpl, logger); err != nil && *requireAuth {
+		os.Exit(1)
+	}
+	if *validateJQL {
+		if err := checkJQL(config, tmpl, logger); err != nil {
+			os.Exit(1)
+		}
+	}
+
+	recent := newRecentAlerts(0, nil)
+	if *enableDebug {
+		var redact []string
+		if *recentRedact != "" {
+			redact = strings.Split(*recentRedact, ",")
+		}
+		recent = newRecentAlerts(*recentSize, redact)
+	}
+
+	proxies, err := parseTrustedProxies(*trustedProxy)
+	if err != nil {
+		level.Error(logger).Log("msg", "error parsing --web.trusted-proxies", "err", err)
+		os.Exit(1)
+	}
+
+	var successTmpl *texttemplate.Template
+	if *successBody != "" {
+		if successTmpl, err = texttemplate.New("success").Parse(*successBody); err != nil {
+			level.Error(logger).Log("msg", "error parsing --alert.success-template", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	var queue *notifyQueue
+	if *async {
+		queue = newNotifyQueue(*asyncQueueSize, *asyncWorkers, tmpl, logger)
+	}
+
+	allowedMethods, allowHeader := parseMethods(*alertMethods)
 	http.HandleFunc("/alert", func(w http.ResponseWriter, req *http.Request) {
+		logger := log.With(logger, "client", proxies.clientIP(req))
 		level.Debug(logger).Log("msg", "handling /alert webhook request")
 		defer func() { _ = req.Body.Close() }()
 
 		// https://godoc.org/github.com/prometheus/alertmanager/template#Data
 		data := alertmanager.Data{}
-		if err := json.NewDecoder(req.Body).Decode(&data); err != nil {
-			errorHandler(w, http.StatusBadRequest, err, unknownReceiver, &data, logger)
+		if !allowedMethods[req.Method] {
+			methodNotAllowedTotal.Inc()
+			w.Header().Set("Allow", allowHeader)
+			errorHandler(w, req, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed, use %s", req.Method, allowHeader), unknownReceiver, &data, logger)
+			return
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			errorHandler(w, req, http.StatusBadRequest, err, unknownReceiver, &data, logger)
 			return
 		}
+		if hmacSecret != nil && !validSignature(body, req.Header.Get("X-Signature"), hmacSecret) {
+			errorHandler(w, req, http.StatusUnauthorized, fmt.Errorf("missing or invalid X-Signature header"), unknownReceiver, &data, logger)
+			return
+		}
+		if *strictDecode {
+			if err := decodeStrict(body, &data); err != nil {
+				strictDecodeRejectedTotal.Inc()
+				errorHandler(w, req, http.StatusBadRequest, err, unknownReceiver, &data, logger)
+				return
+			}
+		} else if err := json.Unmarshal(body, &data); err != nil {
+			errorHandler(w, req, http.StatusBadRequest, err, unknownReceiver, &data, logger)
+			return
+		}
+		recent.Add(data)
 
-		conf := config.ReceiverByName(data.Receiver)
+		conf, matches := config.ReceiverMatch(data.Receiver)
 		if conf == nil {
-			errorHandler(w, http.StatusNotFound, fmt.Errorf("receiver missing: %s", data.Receiver), unknownReceiver, &data, logger)
+			errorHandler(w, req, http.StatusNotFound, fmt.Errorf("receiver missing: %s", data.Receiver), unknownReceiver, &data, logger)
 			return
 		}
 		level.Debug(logger).Log("msg", "  matched receiver", "receiver", conf.Name)
+		data.ReceiverMatches = matches
 
-		// Filter out resolved alerts, not interested in them.
+		// Filter out resolved alerts, not interested in them unless the receiver routes them to its resolved_receiver.
 		alerts := data.Alerts.Firing()
 		if len(alerts) < len(data.Alerts) {
-			level.Warn(logger).Log("msg", "receiver should have \"send_resolved: false\" set in Alertmanager config", "receiver", conf.Name)
+			if conf.ResolvedReceiver != "" {
+				rconf := config.ReceiverByName(conf.ResolvedReceiver)
+				resolved := data
+				resolved.Alerts = data.Alerts.Resolved()
+				resolved.Status = alertmanager.AlertResolved
+				level.Debug(logger).Log("msg", "  routing resolved alerts", "receiver", conf.Name, "resolved_receiver", rconf.Name, "alerts", len(resolved.Alerts))
+				if _, status, err := dispatch(queue, tmpl, rconf, &resolved, logger); err != nil {
+					errorHandler(w, req, status, err, rconf.Name, &resolved, logger)
+					return
+				}
+				if len(alerts) == 0 {
+					countRequest(rconf.Name, http.StatusOK)
+					fmt.Fprint(w, "no firing alerts, resolved alerts handled by "+rconf.Name)
+					return
+				}
+			} else if conf.StatusTransitions[alertmanager.AlertResolved] != "" {
+				if len(alerts) == 0 {
+					// The whole group is resolved, let the receiver transition its issue.
+					data.Status = alertmanager.AlertResolved
+					if _, status, err := dispatch(queue, tmpl, conf, &data, logger); err != nil {
+						errorHandler(w, req, status, err, conf.Name, &data, logger)
+						return
+					}
+					countRequest(conf.Name, http.StatusOK)
+					fmt.Fprint(w, "no firing alerts, resolved status handled")
+					return
+				}
+			} else {
+				level.Warn(logger).Log("msg", "receiver should have \"send_resolved: false\" set in Alertmanager config", "receiver", conf.Name)
+			}
 			data.Alerts = alerts
 		}
 
-		if len(data.Alerts) > 0 {
-			r, err := notify.NewReceiver(conf, tmpl)
-			if err != nil {
-				errorHandler(w, http.StatusInternalServerError, err, conf.Name, &data, logger)
-				return
-			}
-			if retry, err := r.Notify(&data, logger); err != nil {
-				var status int
-				if retry {
-					status = http.StatusServiceUnavailable
-				} else {
-					status = http.StatusInternalServerError
-				}
-				errorHandler(w, status, err, conf.Name, &data, logger)
-				return
-			}
+		if len(data.Alerts) == 0 {
+			level.Debug(logger).Log("msg", "no firing alerts, nothing to do", "receiver", conf.Name)
+			noopTotal.WithLabelValues(conf.Name).Inc()
+			countRequest(conf.Name, http.StatusOK)
+			fmt.Fprint(w, "no firing alerts, no action taken")
+			return
 		}
 
-		requestTotal.WithLabelValues(conf.Name, "200").Inc()
+		issueKey, status, err := dispatch(queue, tmpl, conf, &data, logger)
+		if err != nil {
+			errorHandler(w, req, status, err, conf.Name, &data, logger)
+			return
+		}
+		countRequest(conf.Name, http.StatusOK)
+		if queue != nil {
+			fmt.Fprint(w, "queued")
+			return
+		}
+		if err := writeAlertResponse(w, successTmpl, conf, issueKey); err != nil {
+			level.Warn(logger).Log("msg", "error writing /alert response", "receiver", conf.Name, "err", err)
+		}
 	})
 
-	http.HandleFunc("/", HomeHandlerFunc())
-	http.HandleFunc("/config", ConfigHandlerFunc(config))
+	if *disableUI {
+		http.HandleFunc("/config", ConfigJSONHandlerFunc(config, logger))
+	} else {
+		http.HandleFunc("/", HomeHandlerFunc())
+		http.HandleFunc("/config", ConfigHandlerFunc(config, logger))
+	}
+	http.HandleFunc("/version", VersionHandlerFunc())
 	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { http.Error(w, "OK", http.StatusOK) })
-	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(namespaceGatherer(prometheus.DefaultGatherer, *metricNS), promhttp.HandlerOpts{})))
+	if *enableDebug {
+		http.HandleFunc("/-/render", RenderHandlerFunc(config, tmpl, logger))
+		http.HandleFunc("/-/log-level", LogLevelHandlerFunc(dynamic, logger))
+		http.HandleFunc("/-/recent-alerts", RecentAlertsHandlerFunc(recent))
+	}
 
 	if os.Getenv("PORT") != "" {
 		*listenAddress = ":" + os.Getenv("PORT")
 	}
 
+	var handler http.Handler = http.DefaultServeMux
+	if *accessLog {
+		handler = accessLogHandler(handler, proxies, logger)
+	}
+
 	level.Info(logger).Log("msg", "listening", "address", *listenAddress)
-	err = http.ListenAndServe(*listenAddress, nil)
+	err = http.ListenAndServe(*listenAddress, handler)
 	if err != nil {
 		level.Error(logger).Log("msg", "failed to start HTTP server", "address", *listenAddress)
 		os.Exit(1)
 	}
 }
 
-func errorHandler(w http.ResponseWriter, status int, err error, receiver string, data *alertmanager.Data, logger log.Logger) {
-	w.WriteHeader(status)
+// alertResponse is the body of a successful synchronous /alert response, and the data of --alert.success-template.
+type alertResponse struct {
+	Receiver string `json:"receiver"`
+	IssueKey string `json:"issueKey,omitempty"`
+	IssueURL string `json:"issueURL,omitempty"`
+}
 
-	response := struct {
-		Error   bool
-		Status  int
-		Message string
-	}{
-		true,
-		status,
-		err.Error(),
+// writeAlertResponse writes the body of a successful synchronous /alert response, naming the issue handling the alert
+// group if known. It uses tmpl if not nil, falling back to JSON.
+func writeAlertResponse(w http.ResponseWriter, tmpl *texttemplate.Template, conf *config.ReceiverConfig, issueKey string) error {
+	resp := alertResponse{Receiver: conf.Name, IssueKey: issueKey}
+	if issueKey != "" {
+		resp.IssueURL = strings.TrimSuffix(conf.APIURL, "/") + "/browse/" + issueKey
+	}
+	if tmpl != nil {
+		return tmpl.Execute(w, resp)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(resp)
+}
+
+// checkJiraAuth authenticates once against every distinct JIRA API URL and user pair in the configuration, logging the
+// outcome. It returns the last error encountered, if any.
+func checkJiraAuth(config *config.Config, tmpl *template.Template, logger log.Logger) error {
+	var lastErr error
+	checked := map[string]bool{}
+	for _, conf := range config.Receivers {
+		key := conf.APIURL + "|" + conf.User
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+
+		r, err := notify.NewReceiver(conf, tmpl.ForReceiver(conf.Name))
+		if err == nil {
+			err = r.CheckAuth(logger)
+		}
+		if err != nil {
+			level.Error(logger).Log("msg", "JIRA authentication failed", "api_url", conf.APIURL, "user", conf.User, "receiver", conf.Name, "err", err)
+			lastErr = err
+			continue
+		}
+		level.Info(logger).Log("msg", "JIRA authentication succeeded", "api_url", conf.APIURL, "user", conf.User)
+	}
+	return lastErr
+}
+
+// checkJQL validates the JQL queries of all receivers with JIRA, logging the invalid ones. It returns the last error.
+func checkJQL(config *config.Config, tmpl *template.Template, logger log.Logger) error {
+	var lastErr error
+	for _, conf := range config.Receivers {
+		r, err := notify.NewReceiver(conf, tmpl.ForReceiver(conf.Name))
+		if err == nil {
+			err = r.ValidateJQL(logger)
+		}
+		if err != nil {
+			level.Error(logger).Log("msg", "JQL validation failed", "receiver", conf.Name, "err", err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// decodeStrict decodes a JSON payload, failing on unknown fields and on anything following the payload.
+func decodeStrict(body []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid payload: %s", err)
+	}
+	if dec.More() {
+		return fmt.Errorf("invalid payload: data after the JSON object")
+	}
+	return nil
+}
+
+// validSignature reports whether signature is the hex encoded HMAC-SHA256 of body, optionally prefixed with "sha256=".
+func validSignature(body []byte, signature string, secret []byte) bool {
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// errorHandler responds with the error as JSON or, if the request asks for it with ?format=text, as plain text.
+func errorHandler(w http.ResponseWriter, req *http.Request, status int, err error, receiver string, data *alertmanager.Data, logger log.Logger) {
+	if status == http.StatusServiceUnavailable && *retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64((*retryAfter+time.Second-1)/time.Second), 10))
+	}
+	if req.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		fmt.Fprintln(w, err.Error())
+	} else {
+		response := struct {
+			Error   bool
+			Status  int
+			Message string
+		}{
+			true,
+			status,
+			err.Error(),
+		}
+		// JSON response
+		bytes, _ := json.Marshal(response)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(bytes)
 	}
-	// JSON response
-	bytes, _ := json.Marshal(response)
-	json := string(bytes[:])
-	fmt.Fprint(w, json)
 
 	level.Error(logger).Log("msg", "error handling request", "statusCode", status, "statusText", http.StatusText(status), "err", err, "receiver", receiver, "groupLabels", data.GroupLabels)
-	requestTotal.WithLabelValues(receiver, strconv.FormatInt(int64(status), 10)).Inc()
+	countRequest(receiver, status)
 }
 
-func setupLogger(lvl string, fmt string) (logger log.Logger) {
+// parseMethods parses the comma separated --alert.methods into a set and the value of the Allow header.
+func parseMethods(s string) (map[string]bool, string) {
+	methods := map[string]bool{}
+	var allow []string
+	for _, m := range strings.Split(s, ",") {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m == "" || methods[m] {
+			continue
+		}
+		methods[m] = true
+		allow = append(allow, m)
+	}
+	return methods, strings.Join(allow, ", ")
+}
+
+// dynamicLogger is a log.Logger whose level filter may be changed while in use.
+type dynamicLogger struct {
+	base    log.Logger
+	level   atomic.Value // string
+	current atomic.Value // log.Logger
+}
+
+// Log implements the log.Logger interface.
+func (l *dynamicLogger) Log(keyvals ...interface{}) error {
+	return l.current.Load().(log.Logger).Log(keyvals...)
+}
+
+// Level returns the current log level.
+func (l *dynamicLogger) Level() string {
+	return l.level.Load().(string)
+}
+
+// SetLevel atomically replaces the level filter, returning an error for unknown levels.
+func (l *dynamicLogger) SetLevel(lvl string) error {
 	var filter level.Option
 	switch lvl {
 	case "error":
 		filter = level.AllowError()
 	case "warn":
 		filter = level.AllowWarn()
+	case "info":
+		filter = level.AllowInfo()
 	case "debug":
 		filter = level.AllowDebug()
 	default:
-		filter = level.AllowInfo()
+		return fmt.Errorf("unknown log level %q", lvl)
 	}
+	l.current.Store(level.NewFilter(l.base, filter))
+	l.level.Store(lvl)
+	return nil
+}
 
+func setupLogger(lvl string, fmt string) (logger log.Logger, dynamic *dynamicLogger) {
 	if fmt == logFormatJson {
 		logger = log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
 	} else {
 		logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
 	}
-	logger = level.NewFilter(logger, filter)
-	logger = log.With(logger, "ts", log.DefaultTimestampUTC, "caller", log.DefaultCaller)
+	dynamic = &dynamicLogger{base: logger}
+	if err := dynamic.SetLevel(lvl); err != nil {
+		_ = dynamic.SetLevel("info")
+	}
+	logger = log.With(dynamic, "ts", log.DefaultTimestampUTC, "caller", log.DefaultCaller)
 	return
 }
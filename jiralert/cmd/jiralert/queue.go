@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/config"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/notify"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/template"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// dispatch notifies the receiver or, if queue is not nil, enqueues the notification. It returns the key of the issue
+// handling the alert group, if known, and on failure the HTTP status to respond to Alertmanager with.
+func dispatch(queue *notifyQueue, tmpl *template.Template, conf *config.ReceiverConfig, data *alertmanager.Data, logger log.Logger) (string, int, error) {
+	if queue != nil {
+		if !queue.Enqueue(conf, data) {
+			return "", http.StatusServiceUnavailable, fmt.Errorf("notification queue full")
+		}
+		return "", http.StatusOK, nil
+	}
+
+	r, err := notify.NewReceiver(conf, tmpl.ForReceiver(conf.Name))
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if retry, err := r.Notify(data, logger); err != nil {
+		kind := notify.ErrorKindOf(err)
+		notifyErrorsTotal.WithLabelValues(conf.Name, kind.String()).Inc()
+		switch {
+		case kind == notify.ErrorTransient, kind == notify.ErrorRateLimit:
+			return "", http.StatusServiceUnavailable, err
+		case kind == notify.ErrorUnknown && retry:
+			// Not classified, fall back to what Notify suggests.
+			return "", http.StatusServiceUnavailable, err
+		}
+		return "", http.StatusInternalServerError, err
+	}
+	return r.IssueKey(), http.StatusOK, nil
+}
+
+// notifyJob is a notification accepted by /alert, waiting to be processed.
+type notifyJob struct {
+	conf *config.ReceiverConfig
+	data *alertmanager.Data
+}
+
+// notifyQueue processes notifications in the background, for --async mode.
+//
+// Alertmanager considers a notification delivered as soon as it is enqueued, so delivery is best effort: jobs that
+// fail, or are still queued when JIRAlert exits, are not retried until Alertmanager resends the alert group on its
+// repeat_interval. Synchronous mode is at least once, as Alertmanager retries failed requests.
+type notifyQueue struct {
+	jobs   chan notifyJob
+	tmpl   *template.Template
+	logger log.Logger
+}
+
+// newNotifyQueue returns a queue holding up to size jobs, processed by the given number of workers.
+func newNotifyQueue(size, workers int, tmpl *template.Template, logger log.Logger) *notifyQueue {
+	q := &notifyQueue{
+		jobs:   make(chan notifyJob, size),
+		tmpl:   tmpl,
+		logger: logger,
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// Enqueue adds a job to the queue, returning false if the queue is full.
+func (q *notifyQueue) Enqueue(conf *config.ReceiverConfig, data *alertmanager.Data) bool {
+	select {
+	case q.jobs <- notifyJob{conf: conf, data: data}:
+		queueLength.Set(float64(len(q.jobs)))
+		return true
+	default:
+		queueDroppedTotal.WithLabelValues(conf.Name).Inc()
+		return false
+	}
+}
+
+func (q *notifyQueue) work() {
+	for job := range q.jobs {
+		queueLength.Set(float64(len(q.jobs)))
+		logger := log.With(q.logger, "receiver", job.conf.Name)
+
+		r, err := notify.NewReceiver(job.conf, q.tmpl.ForReceiver(job.conf.Name))
+		if err == nil {
+			_, err = r.Notify(job.data, logger)
+		}
+		if err != nil {
+			level.Error(logger).Log("msg", "error processing queued notification", "err", err, "groupLabels", job.data.GroupLabels)
+			asyncErrorsTotal.WithLabelValues(job.conf.Name).Inc()
+		}
+	}
+}
@@ -1,6 +1,19 @@
 package main
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// defaultNamespace prefixes the names of all of JIRAlert's own metrics, unless --metric-namespace says otherwise.
+const defaultNamespace = "jiralert"
+
+// metricNamespaceRE matches valid values of --metric-namespace.
+var metricNamespaceRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
 
 var (
 	requestTotal = prometheus.NewCounterVec(
@@ -10,8 +23,94 @@ var (
 		},
 		[]string{"receiver", "code"},
 	)
+	// Named apart from jiralert_requests_total, which already exists with other labels.
+	requestClassTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jiralert_requests_by_class_total",
+			Help: "Requests processed, by receiver and status class (2xx, 4xx, 5xx).",
+		},
+		[]string{"receiver", "status_class"},
+	)
+	notifyErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jiralert_notify_errors_total",
+			Help: "Failed notifications, by receiver and kind of error (auth, rate_limit, validation, transient, unknown).",
+		},
+		[]string{"receiver", "kind"},
+	)
+	noopTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jiralert_noop_total",
+			Help: "Requests that required no action because they carried no firing alerts, by receiver.",
+		},
+		[]string{"receiver"},
+	)
+	strictDecodeRejectedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "jiralert_strict_decode_rejected_total",
+			Help: "Requests rejected by --alert.strict-decode, for unknown fields or trailing data in the payload.",
+		},
+	)
+	methodNotAllowedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "jiralert_alert_method_not_allowed_total",
+			Help: "Requests to /alert rejected with 405 Method Not Allowed because their method is not in --alert.methods.",
+		},
+	)
+	queueLength = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "jiralert_queue_length",
+			Help: "Notifications waiting to be processed, in --async mode.",
+		},
+	)
+	queueDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jiralert_queue_dropped_total",
+			Help: "Notifications rejected because the queue was full, in --async mode, by receiver.",
+		},
+		[]string{"receiver"},
+	)
+	asyncErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jiralert_async_errors_total",
+			Help: "Queued notifications that failed, in --async mode, by receiver.",
+		},
+		[]string{"receiver"},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(requestTotal)
+	prometheus.MustRegister(requestClassTotal)
+	prometheus.MustRegister(noopTotal)
+	prometheus.MustRegister(notifyErrorsTotal)
+	prometheus.MustRegister(strictDecodeRejectedTotal)
+	prometheus.MustRegister(methodNotAllowedTotal)
+	prometheus.MustRegister(queueLength)
+	prometheus.MustRegister(queueDroppedTotal)
+	prometheus.MustRegister(asyncErrorsTotal)
+}
+
+// namespaceGatherer returns a Gatherer renaming the metrics of g in defaultNamespace to namespace. Metrics are
+// registered before flags are parsed, so they are renamed when gathered rather than registered under namespace.
+func namespaceGatherer(g prometheus.Gatherer, namespace string) prometheus.Gatherer {
+	if namespace == defaultNamespace {
+		return g
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		for _, mf := range mfs {
+			if name := mf.GetName(); strings.HasPrefix(name, defaultNamespace+"_") {
+				name = namespace + strings.TrimPrefix(name, defaultNamespace)
+				mf.Name = &name
+			}
+		}
+		return mfs, err
+	})
+}
+
+// countRequest counts a processed request in both requestTotal and requestClassTotal.
+func countRequest(receiver string, status int) {
+	requestTotal.WithLabelValues(receiver, strconv.Itoa(status)).Inc()
+	requestClassTotal.WithLabelValues(receiver, strconv.Itoa(status/100)+"xx").Inc()
 }
@@ -14,6 +14,9 @@ const (
 
 	// AlertFiring is the status value for a firing alert.
 	AlertFiring = "firing"
+
+	// AlertResolved is the status value for a resolved alert.
+	AlertResolved = "resolved"
 )
 
 // Pair is a key/value string pair.
@@ -99,6 +102,8 @@ func (kv KV) Values() []string {
 // End-users should not be exposed to Go's type system, as this will confuse them and prevent
 // simple things like simple equality checks to fail. Map everything to float64/string.
 type Data struct {
+	// Version of the webhook payload format, "4" for current Alertmanager releases.
+	Version  string `json:"version"`
 	Receiver string `json:"receiver"`
 	Status   string `json:"status"`
 	Alerts   Alerts `json:"alerts"`
@@ -108,6 +113,13 @@ type Data struct {
 	CommonAnnotations KV `json:"commonAnnotations"`
 
 	ExternalURL string `json:"externalURL"`
+	GroupKey    string `json:"groupKey"`
+
+	// ReceiverMatches holds the parts of Receiver matched by the wildcards of the JIRAlert receiver handling it.
+	ReceiverMatches []string `json:"-"`
+
+	// TruncatedAlerts is the number of alerts left out of Alerts, by Alertmanager or by JIRAlert itself.
+	TruncatedAlerts int `json:"truncatedAlerts"`
 }
 
 // Alert holds one alert for notification templates.
@@ -118,11 +130,34 @@ type Alert struct {
 	StartsAt     time.Time `json:"startsAt"`
 	EndsAt       time.Time `json:"endsAt"`
 	GeneratorURL string    `json:"generatorURL"`
+	Fingerprint  string    `json:"fingerprint"`
 }
 
 // Alerts is a list of Alert objects.
 type Alerts []Alert
 
+// Fingerprints returns the fingerprints of the alerts, in order, skipping alerts without one.
+func (as Alerts) Fingerprints() []string {
+	res := make([]string, 0, len(as))
+	for _, a := range as {
+		if a.Fingerprint != "" {
+			res = append(res, a.Fingerprint)
+		}
+	}
+	return res
+}
+
+// Resolved returns the subset of alerts that are resolved.
+func (as Alerts) Resolved() []Alert {
+	res := []Alert{}
+	for _, a := range as {
+		if a.Status == AlertResolved {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
 // Firing returns the subset of alerts that are firing.
 func (as Alerts) Firing() []Alert {
 	res := []Alert{}
@@ -0,0 +1,43 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testPayload is a webhook payload as sent by Alertmanager.
+const testPayload = `{
+  "receiver": "jira-ab",
+  "status": "firing",
+  "alerts": [
+    {
+      "status": "firing",
+      "labels": {"alertname": "InstanceDown", "instance": "host:9100", "severity": "critical"},
+      "annotations": {"summary": "Instance host:9100 down"},
+      "startsAt": "2019-02-04T10:30:00.000Z",
+      "endsAt": "0001-01-01T00:00:00Z",
+      "generatorURL": "http://prometheus:9090/graph?g0.expr=up+%3D%3D+0",
+      "fingerprint": "a3b1c9d2e4f50617"
+    }
+  ],
+  "groupLabels": {"alertname": "InstanceDown"},
+  "commonLabels": {"alertname": "InstanceDown", "instance": "host:9100", "severity": "critical"},
+  "commonAnnotations": {"summary": "Instance host:9100 down"},
+  "externalURL": "http://alertmanager:9093",
+  "version": "4",
+  "groupKey": "{}:{alertname=\"InstanceDown\"}"
+}`
+
+func TestDecodeData(t *testing.T) {
+	data := Data{}
+	require.NoError(t, json.Unmarshal([]byte(testPayload), &data))
+
+	require.Equal(t, "jira-ab", data.Receiver)
+	require.Equal(t, "http://alertmanager:9093", data.ExternalURL)
+	require.Equal(t, `{}:{alertname="InstanceDown"}`, data.GroupKey)
+	require.Len(t, data.Alerts.Firing(), 1)
+	require.Equal(t, []string{"a3b1c9d2e4f50617"}, data.Alerts.Fingerprints())
+	require.Equal(t, KV{"alertname": "InstanceDown"}, data.GroupLabels)
+}
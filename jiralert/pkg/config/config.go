@@ -1,12 +1,15 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"io/ioutil"
 	"net/url"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
@@ -27,6 +30,14 @@ func (s Secret) MarshalYAML() (interface{}, error) {
 	return nil, nil
 }
 
+// MarshalJSON implements the json.Marshaler interface.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	if s != "" {
+		return []byte(`"<secret>"`), nil
+	}
+	return []byte(`""`), nil
+}
+
 // UnmarshalYAML implements the yaml.Unmarshaler interface for Secrets.
 func (s *Secret) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	type plain Secret
@@ -72,45 +83,586 @@ func resolveFilepaths(baseDir string, cfg *Config, logger log.Logger) {
 	}
 
 	cfg.Template = join(cfg.Template)
+	for _, rc := range cfg.Receivers {
+		rc.TemplateFile = join(rc.TemplateFile)
+		rc.JiraClientCertFile = join(rc.JiraClientCertFile)
+		rc.JiraClientKeyFile = join(rc.JiraClientKeyFile)
+	}
 }
 
+// customFieldRE matches custom field ids.
+var customFieldRE = regexp.MustCompile(`^customfield_[0-9]+$`)
+
+// Values of ReceiverConfig.DescriptionFormat.
+const (
+	DescriptionFormatWiki     = "wiki"
+	DescriptionFormatMarkdown = "markdown"
+)
+
+// Values of ReceiverConfig.LabelFormat.
+const (
+	LabelFormatKeyValue = "key_value"
+	LabelFormatValue    = "value"
+)
+
+// Values of ReceiverConfig.LabelOverflow.
+const (
+	LabelOverflowTruncate = "truncate"
+	LabelOverflowDrop     = "drop"
+)
+
 // ReceiverConfig is the configuration for one receiver. It has a unique name and includes API access fields (URL, user
 // and password) and issue fields (required -- e.g. project, issue type -- and optional -- e.g. priority).
 type ReceiverConfig struct {
+	// Name may contain "*" wildcards, each matching any (possibly empty) sequence of characters.
 	Name string `yaml:"name" json:"name"`
+	// Compiled form of Name, if it contains wildcards.
+	namePattern *regexp.Regexp
+	// Keys present in the YAML receiver, even if set to their zero value.
+	present map[string]bool
 
 	// API access fields
 	APIURL   string `yaml:"api_url" json:"api_url"`
 	User     string `yaml:"user" json:"user"`
 	Password Secret `yaml:"password" json:"password"`
+	// JIRA REST API version, "2" (the default) or "3"
+	APIVersion string `yaml:"api_version" json:"api_version"`
+	// Headers to send with every JIRA request, e.g. a token required by a WAF. Values may be templates (executed
+	// without alert data) and are redacted when the configuration is shown
+	JiraHeaders map[string]Secret `yaml:"jira_headers" json:"jira_headers"`
+	// TLS client certificate and key (PEM files) to present to JIRA, e.g. for mutual TLS
+	JiraClientCertFile string `yaml:"jira_client_cert_file" json:"jira_client_cert_file"`
+	JiraClientKeyFile  string `yaml:"jira_client_key_file" json:"jira_client_key_file"`
+	// User to impersonate in JIRA requests, a template sent in ImpersonateHeader
+	Impersonate       string `yaml:"impersonate" json:"impersonate"`
+	ImpersonateHeader string `yaml:"impersonate_header" json:"impersonate_header"`
 
 	// Required issue fields
 	Project     string `yaml:"project" json:"project"`
 	IssueType   string `yaml:"issue_type" json:"issue_type"`
 	Summary     string `yaml:"summary" json:"summary"`
 	ReopenState string `yaml:"reopen_state" json:"reopen_state"`
+	// Issue type ID, taking precedence over (and optional with) IssueType, for names that are ambiguous across issue
+	// type schemes
+	IssueTypeID string `yaml:"issue_type_id" json:"issue_type_id"`
 
 	// Optional issue fields
-	Priority          string                 `yaml:"priority" json:"priority"`
-	Description       string                 `yaml:"description" json:"description"`
-	WontFixResolution string                 `yaml:"wont_fix_resolution" json:"wont_fix_resolution"`
-	Fields            map[string]interface{} `yaml:"fields" json:"fields"`
-	Components        []string               `yaml:"components" json:"components"`
-	ReopenDuration    *Duration              `yaml:"reopen_duration" json:"reopen_duration"`
+	SummaryPrefix string `yaml:"summary_prefix" json:"summary_prefix"`
+	// Prefix of the annotations ("<prefix>summary" and "<prefix>description", default prefix "jira_") that take
+	// precedence over the default summary and description templates, if common to the alert group
+	AnnotationPrefix string `yaml:"annotation_prefix" json:"annotation_prefix"`
+	// Append " (N alerts)" to the summary if the group has more than this many firing alerts (0 disables)
+	SummaryCountThreshold int                    `yaml:"summary_count_threshold" json:"summary_count_threshold"`
+	Priority              string                 `yaml:"priority" json:"priority"`
+	Description           string                 `yaml:"description" json:"description"`
+	WontFixResolution     string                 `yaml:"wont_fix_resolution" json:"wont_fix_resolution"`
+	Fields                map[string]interface{} `yaml:"fields" json:"fields"`
+	// Names of fields to submit even if their value renders empty, which otherwise leaves them out
+	KeepEmptyFields []string `yaml:"keep_empty_fields" json:"keep_empty_fields"`
+	// Names of fields whose rendered value is submitted as a JSON number, e.g. for number custom fields
+	NumericFields     []string  `yaml:"numeric_fields" json:"numeric_fields"`
+	Components        []string  `yaml:"components" json:"components"`
+	ResolveIDs        bool      `yaml:"resolve_ids" json:"resolve_ids"`
+	OriginalEstimate  string    `yaml:"original_estimate" json:"original_estimate"`
+	RemainingEstimate string    `yaml:"remaining_estimate" json:"remaining_estimate"`
+	ReopenDuration    *Duration `yaml:"reopen_duration" json:"reopen_duration"`
+	// Upper bound on the time since resolution for reopening an issue, on top of ReopenDuration, e.g. set in the
+	// defaults to guard against receivers with a long reopen_duration
+	ReopenMaxAge *Duration `yaml:"reopen_max_age" json:"reopen_max_age"`
+	// Time after creating an issue during which a search not finding it is attributed to JIRA's index lag
+	DedupGrace *Duration `yaml:"dedup_grace" json:"dedup_grace"`
+	// Maximum duration of a notification, including all of its JIRA requests. Overrides --jira-timeout, 0 disables it
+	Timeout *Duration `yaml:"timeout" json:"timeout"`
+	// Maximum time to wait, after creating an issue, until JIRA returns it when fetched by key
+	WaitForIssue *Duration `yaml:"wait_for_issue" json:"wait_for_issue"`
+	// Transition (name or ID) to perform right after creating an issue
+	PostCreateTransition string `yaml:"post_create_transition" json:"post_create_transition"`
+	// Transition (name or ID) to perform on the unresolved issue of an alert group, by status of the group: "firing"
+	// on every notification of the group, "resolved" once all of its alerts are resolved
+	StatusTransitions map[string]string `yaml:"status_transitions" json:"status_transitions"`
+	// Time the alert group must stay resolved before the "resolved" status transition is performed
+	AutoResolveDelay *Duration `yaml:"auto_resolve_delay" json:"auto_resolve_delay"`
+	// Receiver to hand resolved alerts to, instead of ignoring them
+	ResolvedReceiver string `yaml:"resolved_receiver" json:"resolved_receiver"`
+	// Fail the notification if a step after creating the issue (wait for issue, transition, attachment, notify webhook)
+	// fails. By default such failures are only logged and counted, as the issue exists and a retry would not repeat
+	// the step
+	FailOnPostCreateError bool `yaml:"fail_on_post_create_error" json:"fail_on_post_create_error"`
+	// Retry creating an issue without the fields JIRA rejected (logging them), instead of failing
+	DropInvalidFields bool `yaml:"drop_invalid_fields" json:"drop_invalid_fields"`
+	// Create a minimal issue without templates, labeled JIRALERT_TEMPLATE_ERROR, if the issue fails to render
+	TemplateErrorFallback bool `yaml:"template_error_fallback" json:"template_error_fallback"`
+
+	// Markup the description template renders, DescriptionFormatWiki (the default) or DescriptionFormatMarkdown, which
+	// is converted to JIRA wiki markup before submission
+	DescriptionFormat string `yaml:"description_format" json:"description_format"`
+
+	// Description size settings
+	MaxDescriptionChars    int  `yaml:"max_description_chars" json:"max_description_chars"`
+	AttachFullDescription  bool `yaml:"attach_full_description" json:"attach_full_description"`
+	MaxAlertsInDescription int  `yaml:"max_alerts_in_description" json:"max_alerts_in_description"`
+	// Attach all alerts of the group, with their labels, to created issues as alerts.csv
+	AttachCSV bool `yaml:"attach_csv" json:"attach_csv"`
+	// Attach an image fetched from an HTTP endpoint, e.g. a Grafana panel rendering, to created issues
+	AttachImage *AttachImageConfig `yaml:"attach_image" json:"attach_image"`
+	// Add the generator URLs of the alerts to created issues as remote ("Web") links
+	AddRemoteLinks bool `yaml:"add_remote_links" json:"add_remote_links"`
+
+	// Recurring weekly windows during which issues are created. Outside of them, creation is suppressed (until
+	// Alertmanager repeats the notification). Always active if empty
+	ActiveTimeIntervals []*TimeInterval `yaml:"active_time_intervals" json:"active_time_intervals"`
+
+	// Time zone for the localTime template function, e.g. "Europe/Istanbul" (default: UTC)
+	Timezone string `yaml:"timezone" json:"timezone"`
+	location *time.Location
+
+	// Receiver specific template definitions, in addition to the shared template file
+	TemplateFile string `yaml:"template_file" json:"template_file"`
+	// Left and right delimiters of the receiver's templates and template file, instead of "{{" and "}}"
+	Delims []string `yaml:"delims" json:"delims"`
+
+	// JIRA Service Management customer request type (e.g. "itsm/incident") and the custom field holding it
+	RequestType      string `yaml:"request_type" json:"request_type"`
+	RequestTypeField string `yaml:"request_type_field" json:"request_type_field"`
+
+	// Key of the epic to link created issues to and the field holding it: the Epic Link custom field of
+	// company-managed projects (e.g. "customfield_10014") or "parent" for team-managed ones
+	EpicLink      string `yaml:"epic_link" json:"epic_link"`
+	EpicLinkField string `yaml:"epic_link_field" json:"epic_link_field"`
+
+	// Fields to store the Alertmanager external URL and group key in
+	ExternalURLField string `yaml:"external_url_field" json:"external_url_field"`
+	GroupKeyField    string `yaml:"group_key_field" json:"group_key_field"`
+	// Field to store the comma separated fingerprints of the firing alerts in, and whether to add them as
+	// "fingerprint_<fingerprint>" labels as well
+	FingerprintsField string `yaml:"fingerprints_field" json:"fingerprints_field"`
+	FingerprintLabels bool   `yaml:"fingerprint_labels" json:"fingerprint_labels"`
+	// Field to store the runbook_url common annotation in, if present
+	RunbookField string `yaml:"runbook_field" json:"runbook_field"`
+	// Number field to store the number of firing alerts in, on creation and whenever it changes while unresolved
+	AlertCountField string `yaml:"alert_count_field" json:"alert_count_field"`
+	// Priorities to raise an unresolved issue to once its alert group has at least this many firing alerts
+	EscalatePriority map[int]string `yaml:"escalate_priority" json:"escalate_priority"`
+	// Create a new issue when the issue found for the alert group turns out to no longer exist (404 Not Found)
+	RecreateOnMissing bool `yaml:"recreate_on_missing" json:"recreate_on_missing"`
+	// Comment to add to an unresolved issue when its alert group fires again, at most once per HeartbeatInterval
+	HeartbeatComment  string    `yaml:"heartbeat_comment" json:"heartbeat_comment"`
+	HeartbeatInterval *Duration `yaml:"heartbeat_interval" json:"heartbeat_interval"`
+
+	// Only create an issue if this JQL matches no issues, optionally commenting on the first match instead
+	PreconditionJQL     string `yaml:"precondition_jql" json:"precondition_jql"`
+	PreconditionComment string `yaml:"precondition_comment" json:"precondition_comment"`
+	// Instead of creating an issue, adopt an unresolved issue in the project with the exact same summary
+	SummaryUnique bool `yaml:"summary_unique" json:"summary_unique"`
+
+	// Restricts the visibility of comments added by JIRAlert
+	CommentVisibility *CommentVisibility `yaml:"comment_visibility" json:"comment_visibility"`
+
+	// External hook modifying the issue before it is created
+	Transform *TransformConfig `yaml:"transform" json:"transform"`
+	// Assignee of created issues, a template rendering a user name (API version 2) or account ID (API version 3)
+	Assignee string `yaml:"assignee" json:"assignee"`
+	// Endpoint looked up for the assignee of created issues, e.g. the current on-call person, instead of Assignee
+	OnCall *OnCallConfig `yaml:"on_call" json:"on_call"`
+	// Chat webhook (e.g. Slack or Microsoft Teams) to post to after an issue was created
+	NotifyWebhook *NotifyWebhookConfig `yaml:"notify_webhook" json:"notify_webhook"`
+	// Comment alert groups on a daily digest issue rather than creating an issue per alert group
+	Digest *DigestConfig `yaml:"digest" json:"digest"`
+
+	// How the key identifying the issue of an alert group is stored: as a label named "<prefix>{<group labels>}"
+	// (prefix "ALERT" by default) or, if DedupField is set, in that text custom field instead of a label
+	DedupLabelPrefix string `yaml:"dedup_label_prefix" json:"dedup_label_prefix"`
+	DedupField       string `yaml:"dedup_field" json:"dedup_field"`
+	// Template rendering the identity of an alert group, hashed into the key as "<prefix>{<hash>}", instead of the
+	// group labels
+	DedupKeyTemplate string `yaml:"dedup_key_template" json:"dedup_key_template"`
+	// Group labels forming the key (all by default), or else group labels left out of it as they change while an
+	// incident lasts
+	DedupLabels       []string `yaml:"dedup_labels" json:"dedup_labels"`
+	DedupIgnoreLabels []string `yaml:"dedup_ignore_labels" json:"dedup_ignore_labels"`
 
 	// Label copy settings
 	AddGroupLabels bool `yaml:"add_group_labels" json:"add_group_labels"`
+	// Alert label names to add as JIRA labels (limiting add_group_labels to them too), formatted according to
+	// LabelFormat: LabelFormatKeyValue (the default, "name_value") or LabelFormatValue
+	LabelAllowlist []string `yaml:"label_allowlist" json:"label_allowlist"`
+	LabelFormat    string   `yaml:"label_format" json:"label_format"`
+	// Add a "<ReceiverLabelKey>:<receiver>" label (key "receiver" by default) naming the Alertmanager receiver
+	TagReceiver      bool   `yaml:"tag_receiver" json:"tag_receiver"`
+	ReceiverLabelKey string `yaml:"receiver_label_key" json:"receiver_label_key"`
+	// Bring the labels of an existing unresolved issue in line with the alert group on every notification
+	UpdateLabels bool `yaml:"update_labels" json:"update_labels"`
+	// Like UpdateLabels, but also update the fields, and compute both from the still firing alerts only
+	StripResolvedOnUpdate bool `yaml:"strip_resolved_on_update" json:"strip_resolved_on_update"`
+	// Labels to add, each rendered and split on LabelSeparator (default ","), e.g. from a comma separated annotation
+	Labels         []string `yaml:"labels" json:"labels"`
+	LabelSeparator string   `yaml:"label_separator" json:"label_separator"`
+	// Also split the rendered labels on newlines
+	LabelsMultiline bool `yaml:"labels_multiline" json:"labels_multiline"`
+	// Maximum number of labels per issue (0 means no limit). The dedup label and static labels are kept first
+	MaxLabels int `yaml:"max_labels" json:"max_labels"`
+	// What to do with labels longer than JIRA allows, LabelOverflowTruncate (the default) or LabelOverflowDrop
+	LabelOverflow string `yaml:"label_overflow" json:"label_overflow"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// CommentVisibility restricts a comment to the members of a project role or group.
+type CommentVisibility struct {
+	// Either "role" or "group".
+	Type  string `yaml:"type" json:"type"`
+	Value string `yaml:"value" json:"value"`
 
 	// Catches all undefined fields and must be empty after parsing.
 	XXX map[string]interface{} `yaml:",inline" json:"-"`
 }
 
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (cv *CommentVisibility) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain CommentVisibility
+	if err := unmarshal((*plain)(cv)); err != nil {
+		return err
+	}
+	if cv.Type != "role" && cv.Type != "group" {
+		return fmt.Errorf("invalid comment_visibility type %q, must be \"role\" or \"group\"", cv.Type)
+	}
+	if cv.Value == "" {
+		return fmt.Errorf("missing value in comment_visibility")
+	}
+	return checkOverflow(cv.XXX, "comment_visibility")
+}
+
+// TimeInterval is a recurring weekly time window, like a (simplified) Alertmanager time interval.
+type TimeInterval struct {
+	// Days of the week ("monday") or inclusive ranges of them ("monday:friday"), every day if empty.
+	Weekdays []string `yaml:"weekdays" json:"weekdays"`
+	// Times of day, all day if empty.
+	Times []TimeRange `yaml:"times" json:"times"`
+	// Time zone the interval is in, e.g. "Europe/Istanbul" (default: the receiver's timezone).
+	Location string `yaml:"location" json:"location"`
+
+	days     [7]bool
+	location *time.Location
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// TimeRange is a range of the day, from StartTime (inclusive) to EndTime (exclusive), both "HH:MM".
+type TimeRange struct {
+	StartTime string `yaml:"start_time" json:"start_time"`
+	EndTime   string `yaml:"end_time" json:"end_time"`
+
+	start, end int // Minutes since midnight.
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (ti *TimeInterval) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain TimeInterval
+	if err := unmarshal((*plain)(ti)); err != nil {
+		return err
+	}
+	if len(ti.Weekdays) == 0 {
+		ti.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	for _, w := range ti.Weekdays {
+		parts := strings.SplitN(strings.ToLower(strings.TrimSpace(w)), ":", 2)
+		first, ok := weekdays[parts[0]]
+		last := first
+		if ok && len(parts) == 2 {
+			last, ok = weekdays[parts[1]]
+		}
+		if !ok {
+			return fmt.Errorf("invalid weekday %q in active_time_intervals", w)
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			ti.days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	if ti.Location != "" {
+		loc, err := time.LoadLocation(ti.Location)
+		if err != nil {
+			return fmt.Errorf("invalid location %q in active_time_intervals: %s", ti.Location, err)
+		}
+		ti.location = loc
+	}
+	return checkOverflow(ti.XXX, "active_time_intervals")
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (tr *TimeRange) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain TimeRange
+	if err := unmarshal((*plain)(tr)); err != nil {
+		return err
+	}
+	var err error
+	if tr.start, err = parseTimeOfDay(tr.StartTime); err != nil {
+		return err
+	}
+	if tr.end, err = parseTimeOfDay(tr.EndTime); err != nil {
+		return err
+	}
+	if tr.start >= tr.end {
+		return fmt.Errorf("start_time %q must be before end_time %q in active_time_intervals", tr.StartTime, tr.EndTime)
+	}
+	return checkOverflow(tr.XXX, "times")
+}
+
+// parseTimeOfDay returns the minutes since midnight of a "HH:MM" time, where "24:00" is the end of the day.
+func parseTimeOfDay(s string) (int, error) {
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q in active_time_intervals, expected e.g. \"09:00\"", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains reports whether t is within the interval, using loc unless the interval has a location of its own.
+func (ti *TimeInterval) Contains(t time.Time, loc *time.Location) bool {
+	if ti.location != nil {
+		loc = ti.location
+	}
+	t = t.In(loc)
+	if !ti.days[t.Weekday()] {
+		return false
+	}
+	if len(ti.Times) == 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	for _, tr := range ti.Times {
+		if minute >= tr.start && minute < tr.end {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveAt reports whether the receiver creates issues at time t, i.e. t is within one of its active time intervals
+// or it has none.
+func (rc *ReceiverConfig) ActiveAt(t time.Time) bool {
+	if len(rc.ActiveTimeIntervals) == 0 {
+		return true
+	}
+	for _, ti := range rc.ActiveTimeIntervals {
+		if ti.Contains(t, rc.Location()) {
+			return true
+		}
+	}
+	return false
+}
+
+// TransformConfig configures an HTTP endpoint that receives each issue as JSON before it is created and responds with
+// the (possibly modified) issue to submit instead.
+type TransformConfig struct {
+	URL     string    `yaml:"url" json:"url"`
+	Timeout *Duration `yaml:"timeout" json:"timeout"`
+	// Submit the issue unchanged if the transform fails, rather than failing the notification.
+	FailOpen bool `yaml:"fail_open" json:"fail_open"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (tc *TransformConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain TransformConfig
+	if err := unmarshal((*plain)(tc)); err != nil {
+		return err
+	}
+	if tc.URL == "" {
+		return fmt.Errorf("missing url in transform")
+	}
+	if _, err := url.Parse(tc.URL); err != nil {
+		return fmt.Errorf("invalid transform url %q: %s", tc.URL, err)
+	}
+	if tc.Timeout == nil {
+		timeout := Duration(5 * time.Second)
+		tc.Timeout = &timeout
+	}
+	return checkOverflow(tc.XXX, "transform")
+}
+
+// OnCallConfig configures an HTTP endpoint returning the assignee of created issues as a JSON object, e.g. a service
+// proxying the current on-call person of a team from PagerDuty or Opsgenie.
+type OnCallConfig struct {
+	// Template, executed with the alert data, e.g. to pass the team label
+	URL string `yaml:"url" json:"url"`
+	// Headers sent with the request, e.g. an API token. Redacted when the configuration is shown
+	Headers map[string]Secret `yaml:"headers" json:"headers"`
+	// Field of the response holding the assignee, "assignee" by default
+	Field   string    `yaml:"field" json:"field"`
+	Timeout *Duration `yaml:"timeout" json:"timeout"`
+	// Time a looked up assignee is reused for the same URL, 1m by default
+	CacheTTL *Duration `yaml:"cache_ttl" json:"cache_ttl"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (oc *OnCallConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain OnCallConfig
+	if err := unmarshal((*plain)(oc)); err != nil {
+		return err
+	}
+	if oc.URL == "" {
+		return fmt.Errorf("missing url in on_call")
+	}
+	if oc.Field == "" {
+		oc.Field = "assignee"
+	}
+	if oc.Timeout == nil {
+		timeout := Duration(5 * time.Second)
+		oc.Timeout = &timeout
+	}
+	if oc.CacheTTL == nil {
+		ttl := Duration(time.Minute)
+		oc.CacheTTL = &ttl
+	}
+	return checkOverflow(oc.XXX, "on_call")
+}
+
+// AttachImageConfig configures an image, e.g. a Grafana panel rendered by its /render endpoint, fetched (GET) and
+// attached to created issues.
+type AttachImageConfig struct {
+	// Template, executed with the alert data, e.g. to select the panel's variables from alert labels
+	URL string `yaml:"url" json:"url"`
+	// Headers sent with the request, e.g. a Grafana API token. Redacted when the configuration is shown
+	Headers map[string]Secret `yaml:"headers" json:"headers"`
+	// Name of the attachment, "panel.png" by default
+	Filename string    `yaml:"filename" json:"filename"`
+	Timeout  *Duration `yaml:"timeout" json:"timeout"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (ai *AttachImageConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain AttachImageConfig
+	if err := unmarshal((*plain)(ai)); err != nil {
+		return err
+	}
+	if ai.URL == "" {
+		return fmt.Errorf("missing url in attach_image")
+	}
+	if ai.Filename == "" {
+		ai.Filename = "panel.png"
+	}
+	if ai.Timeout == nil {
+		timeout := Duration(30 * time.Second)
+		ai.Timeout = &timeout
+	}
+	return checkOverflow(ai.XXX, "attach_image")
+}
+
+// DefaultNotifyWebhookPayload is the payload posted to a notify webhook if none is configured. Both Slack and Microsoft
+// Teams incoming webhooks accept it.
+const DefaultNotifyWebhookPayload = `{"text": {{ printf "JIRA issue %s created: %s" .IssueKey .IssueURL | toJSON }}}`
+
+// NotifyWebhookConfig configures an HTTP endpoint that a templated JSON payload is posted to after an issue was
+// created. The payload template is executed with the Alertmanager data plus the created issue's IssueKey and IssueURL.
+type NotifyWebhookConfig struct {
+	URL     Secret    `yaml:"url" json:"url"`
+	Payload string    `yaml:"payload" json:"payload"`
+	Timeout *Duration `yaml:"timeout" json:"timeout"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// DigestConfig makes a receiver collect its alert groups on one issue per day, a comment per notification, instead of
+// creating an issue per alert group. Days start at Rollover ("HH:MM", midnight by default) in the receiver's time
+// zone.
+type DigestConfig struct {
+	// Summary of digest issues, followed by the date the day started. Defaults to "JIRAlert digest <receiver>"
+	Summary  string `yaml:"summary" json:"summary"`
+	Rollover string `yaml:"rollover" json:"rollover"`
+
+	rollover int // Minutes since midnight.
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (dc *DigestConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain DigestConfig
+	if err := unmarshal((*plain)(dc)); err != nil {
+		return err
+	}
+	if dc.Rollover != "" {
+		t, err := time.Parse("15:04", dc.Rollover)
+		if err != nil {
+			return fmt.Errorf("invalid digest rollover %q, expected e.g. \"09:00\"", dc.Rollover)
+		}
+		dc.rollover = t.Hour()*60 + t.Minute()
+	}
+	return checkOverflow(dc.XXX, "digest")
+}
+
+// PeriodStart returns the start of the digest day t is in, in loc.
+func (dc *DigestConfig) PeriodStart(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, dc.rollover, 0, 0, loc)
+	if t.Before(start) {
+		start = time.Date(t.Year(), t.Month(), t.Day()-1, 0, dc.rollover, 0, 0, loc)
+	}
+	return start
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (wc *NotifyWebhookConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain NotifyWebhookConfig
+	if err := unmarshal((*plain)(wc)); err != nil {
+		return err
+	}
+	if wc.URL == "" {
+		return fmt.Errorf("missing url in notify_webhook")
+	}
+	if _, err := url.Parse(string(wc.URL)); err != nil {
+		return fmt.Errorf("invalid notify_webhook url: %s", err)
+	}
+	if wc.Payload == "" {
+		wc.Payload = DefaultNotifyWebhookPayload
+	}
+	if wc.Timeout == nil {
+		timeout := Duration(5 * time.Second)
+		wc.Timeout = &timeout
+	}
+	return checkOverflow(wc.XXX, "notify_webhook")
+}
+
 // UnmarshalYAML implements the yaml.Unmarshaler interface.
 func (rc *ReceiverConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	type plain ReceiverConfig
 	if err := unmarshal((*plain)(rc)); err != nil {
 		return err
 	}
+	var keys map[string]interface{}
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	rc.present = make(map[string]bool, len(keys))
+	for key := range keys {
+		rc.present[key] = true
+	}
 	// Recursively convert any maps to map[string]interface{}, filtering out all non-string keys, so the json encoder
 	// doesn't blow up when marshaling JIRA requests.
 	fieldsWithStringKeys, err := tcontainer.ConvertToMarshalMap(rc.Fields, func(v string) string { return v })
@@ -121,11 +673,66 @@ func (rc *ReceiverConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 	return checkOverflow(rc.XXX, "receiver")
 }
 
+// LeftDelim returns the left delimiter of the receiver's templates.
+func (rc *ReceiverConfig) LeftDelim() string {
+	if len(rc.Delims) == 2 {
+		return rc.Delims[0]
+	}
+	return "{{"
+}
+
+// Templates returns all Go templates in the receiver's configuration, i.e. its string values (including those nested
+// in fields) that contain the left delimiter, "{{" unless delims are set.
+func (rc *ReceiverConfig) Templates() []string {
+	var res []string
+	left := rc.LeftDelim()
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.String:
+			if s := v.String(); strings.Contains(s, left) {
+				res = append(res, s)
+			}
+		case reflect.Ptr, reflect.Interface:
+			if !v.IsNil() {
+				walk(v.Elem())
+			}
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				if v.Type().Field(i).PkgPath == "" {
+					walk(v.Field(i))
+				}
+			}
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i))
+			}
+		case reflect.Map:
+			for _, k := range v.MapKeys() {
+				walk(k)
+				walk(v.MapIndex(k))
+			}
+		}
+	}
+	walk(reflect.ValueOf(rc))
+	return res
+}
+
+// Location returns the receiver's time zone, UTC unless configured otherwise.
+func (rc *ReceiverConfig) Location() *time.Location {
+	if rc.location == nil {
+		return time.UTC
+	}
+	return rc.location
+}
+
 // Config is the top-level configuration for JIRAlert's config file.
 type Config struct {
 	Defaults  *ReceiverConfig   `yaml:"defaults,omitempty" json:"defaults,omitempty"`
 	Receivers []*ReceiverConfig `yaml:"receivers,omitempty" json:"receivers,omitempty"`
 	Template  string            `yaml:"template" json:"template"`
+	// Maximum number of notifications handled concurrently per JIRA instance, keyed by api_url
+	JiraConcurrency map[string]int `yaml:"jira_concurrency,omitempty" json:"jira_concurrency,omitempty"`
 
 	// Catches all undefined fields and must be empty after parsing.
 	XXX map[string]interface{} `yaml:",inline" json:"-"`
@@ -139,6 +746,51 @@ func (c Config) String() string {
 	return string(b)
 }
 
+// JSON returns the configuration marshaled as indented JSON, with secrets redacted. Struct fields are emitted in
+// declaration order and map keys sorted, so the output is stable across calls.
+func (c Config) JSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// noMerge lists the ReceiverConfig fields mergeDefaults leaves alone: Fields is merged key by key and a default
+// ResolvedReceiver would make the resolved receiver reference itself.
+var noMerge = map[string]bool{"Name": true, "Fields": true, "ResolvedReceiver": true, "XXX": true}
+
+// mergeDefaults sets every exported field of rc that the receiver doesn't set to the value in defaults, and adds the
+// default fields the receiver doesn't set. A field set to its zero value, e.g. false or 0, counts as set, unless rc
+// wasn't read from YAML.
+func mergeDefaults(rc, defaults *ReceiverConfig) {
+	v, d := reflect.ValueOf(rc).Elem(), reflect.ValueOf(defaults).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" || noMerge[field.Name] {
+			continue
+		}
+		if key := strings.Split(field.Tag.Get("yaml"), ",")[0]; rc.present[key] {
+			continue
+		}
+		if v.Field(i).IsZero() {
+			v.Field(i).Set(d.Field(i))
+		}
+	}
+
+	if len(defaults.Fields) > 0 && rc.Fields == nil {
+		rc.Fields = map[string]interface{}{}
+	}
+	for key, value := range defaults.Fields {
+		if _, ok := rc.Fields[key]; !ok {
+			rc.Fields[key] = value
+		}
+	}
+}
+
 // UnmarshalYAML implements the yaml.Unmarshaler interface.
 func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	// We want to set c to the defaults and then overwrite it with the input.
@@ -153,100 +805,288 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		if rc.Name == "" {
 			return fmt.Errorf("missing name for receiver %+v", rc)
 		}
+		if strings.Contains(rc.Name, "*") {
+			parts := strings.Split(rc.Name, "*")
+			for i := range parts {
+				parts[i] = regexp.QuoteMeta(parts[i])
+			}
+			rc.namePattern = regexp.MustCompile("^" + strings.Join(parts, "(.*)") + "$")
+		}
+
+		if c.Defaults != nil {
+			mergeDefaults(rc, c.Defaults)
+		}
 
 		// Check API access fields
 		if rc.APIURL == "" {
-			if c.Defaults.APIURL == "" {
-				return fmt.Errorf("missing api_url in receiver %q", rc.Name)
-			}
-			rc.APIURL = c.Defaults.APIURL
+			return fmt.Errorf("missing api_url in receiver %q", rc.Name)
 		}
 		if _, err := url.Parse(rc.APIURL); err != nil {
 			return fmt.Errorf("invalid api_url %q in receiver %q: %s", rc.APIURL, rc.Name, err)
 		}
 		if rc.User == "" {
-			if c.Defaults.User == "" {
-				return fmt.Errorf("missing user in receiver %q", rc.Name)
-			}
-			rc.User = c.Defaults.User
+			return fmt.Errorf("missing user in receiver %q", rc.Name)
 		}
 		if rc.Password == "" {
-			if c.Defaults.Password == "" {
-				return fmt.Errorf("missing password in receiver %q", rc.Name)
+			return fmt.Errorf("missing password in receiver %q", rc.Name)
+		}
+
+		for name := range rc.JiraHeaders {
+			if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+				return fmt.Errorf("invalid jira_headers name %q in receiver %q", name, rc.Name)
 			}
-			rc.Password = c.Defaults.Password
+		}
+		if rc.Impersonate != "" && rc.ImpersonateHeader == "" {
+			return fmt.Errorf("impersonate without impersonate_header in receiver %q", rc.Name)
+		}
+		if strings.ContainsAny(rc.ImpersonateHeader, " \t\r\n:") {
+			return fmt.Errorf("invalid impersonate_header %q in receiver %q", rc.ImpersonateHeader, rc.Name)
+		}
+		if (rc.JiraClientCertFile == "") != (rc.JiraClientKeyFile == "") {
+			return fmt.Errorf("jira_client_cert_file and jira_client_key_file must be set together in receiver %q", rc.Name)
+		}
+		if rc.APIVersion == "" {
+			rc.APIVersion = "2"
+		}
+		if rc.APIVersion != "2" && rc.APIVersion != "3" {
+			return fmt.Errorf("unsupported api_version %q in receiver %q, must be \"2\" or \"3\"", rc.APIVersion, rc.Name)
 		}
 
 		// Check required issue fields
 		if rc.Project == "" {
-			if c.Defaults.Project == "" {
-				return fmt.Errorf("missing project in receiver %q", rc.Name)
-			}
-			rc.Project = c.Defaults.Project
+			return fmt.Errorf("missing project in receiver %q", rc.Name)
 		}
-		if rc.IssueType == "" {
-			if c.Defaults.IssueType == "" {
-				return fmt.Errorf("missing issue_type in receiver %q", rc.Name)
-			}
-			rc.IssueType = c.Defaults.IssueType
+		if rc.IssueType == "" && rc.IssueTypeID == "" {
+			return fmt.Errorf("missing issue_type in receiver %q", rc.Name)
 		}
 		if rc.Summary == "" {
-			if c.Defaults.Summary == "" {
-				return fmt.Errorf("missing summary in receiver %q", rc.Name)
-			}
-			rc.Summary = c.Defaults.Summary
+			return fmt.Errorf("missing summary in receiver %q", rc.Name)
 		}
 		if rc.ReopenState == "" {
-			if c.Defaults.ReopenState == "" {
-				return fmt.Errorf("missing reopen_state in receiver %q", rc.Name)
-			}
-			rc.ReopenState = c.Defaults.ReopenState
+			return fmt.Errorf("missing reopen_state in receiver %q", rc.Name)
 		}
 		if rc.ReopenDuration == nil {
-			if c.Defaults.ReopenDuration == nil {
-				return fmt.Errorf("missing reopen_duration in receiver %q", rc.Name)
-			}
-			rc.ReopenDuration = c.Defaults.ReopenDuration
+			return fmt.Errorf("missing reopen_duration in receiver %q", rc.Name)
 		}
 
 		// Populate optional issue fields, where necessary
-		if rc.Priority == "" && c.Defaults.Priority != "" {
-			rc.Priority = c.Defaults.Priority
+		if rc.RequestType != "" && rc.RequestTypeField == "" {
+			return fmt.Errorf("request_type without request_type_field in receiver %q", rc.Name)
 		}
-		if rc.Description == "" && c.Defaults.Description != "" {
-			rc.Description = c.Defaults.Description
+		if len(rc.DedupLabels) > 0 && len(rc.DedupIgnoreLabels) > 0 {
+			return fmt.Errorf("dedup_labels and dedup_ignore_labels can't be combined in receiver %q", rc.Name)
 		}
-		if rc.WontFixResolution == "" && c.Defaults.WontFixResolution != "" {
-			rc.WontFixResolution = c.Defaults.WontFixResolution
+		if rc.DedupKeyTemplate != "" && (len(rc.DedupLabels) > 0 || len(rc.DedupIgnoreLabels) > 0) {
+			return fmt.Errorf("dedup_key_template can't be combined with dedup_labels or dedup_ignore_labels in receiver %q", rc.Name)
 		}
-		if len(c.Defaults.Fields) > 0 {
-			for key, value := range c.Defaults.Fields {
-				if _, ok := rc.Fields[key]; !ok {
-					rc.Fields[key] = value
-				}
+		if rc.Digest != nil && rc.DedupField != "" {
+			return fmt.Errorf("digest and dedup_field can't be combined in receiver %q", rc.Name)
+		}
+		if rc.EpicLink != "" && rc.EpicLinkField == "" {
+			return fmt.Errorf("epic_link without epic_link_field in receiver %q", rc.Name)
+		}
+		for status, transition := range rc.StatusTransitions {
+			if status != "firing" && status != "resolved" {
+				return fmt.Errorf("invalid status_transitions status %q in receiver %q, must be \"firing\" or \"resolved\"", status, rc.Name)
+			}
+			if transition == "" {
+				return fmt.Errorf("empty status_transitions transition for %q in receiver %q", status, rc.Name)
+			}
+		}
+		if rc.HeartbeatComment != "" && rc.HeartbeatInterval == nil {
+			d := Duration(time.Hour)
+			rc.HeartbeatInterval = &d
+		}
+		if rc.HeartbeatInterval != nil && *rc.HeartbeatInterval <= 0 {
+			return fmt.Errorf("non-positive heartbeat_interval in receiver %q", rc.Name)
+		}
+		if rc.PreconditionComment != "" && rc.PreconditionJQL == "" {
+			return fmt.Errorf("precondition_comment without precondition_jql in receiver %q", rc.Name)
+		}
+		if rc.Timezone != "" {
+			loc, err := time.LoadLocation(rc.Timezone)
+			if err != nil {
+				return fmt.Errorf("invalid timezone %q in receiver %q: %s", rc.Timezone, rc.Name, err)
 			}
+			rc.location = loc
+		}
+		switch rc.DescriptionFormat {
+		case "":
+			rc.DescriptionFormat = DescriptionFormatWiki
+		case DescriptionFormatWiki, DescriptionFormatMarkdown:
+		default:
+			return fmt.Errorf("invalid description_format %q in receiver %q, must be %q or %q", rc.DescriptionFormat, rc.Name, DescriptionFormatWiki, DescriptionFormatMarkdown)
+		}
+		if rc.DescriptionFormat == DescriptionFormatMarkdown && rc.APIVersion != "2" {
+			// API version 3 takes Atlassian Document Format rather than wiki markup.
+			return fmt.Errorf("description_format %q requires api_version \"2\" in receiver %q", rc.DescriptionFormat, rc.Name)
+		}
+		if rc.MaxLabels < 0 {
+			return fmt.Errorf("negative max_labels in receiver %q", rc.Name)
+		}
+		for threshold, priority := range rc.EscalatePriority {
+			if threshold <= 0 || priority == "" {
+				return fmt.Errorf("invalid escalate_priority %d: %q in receiver %q, must map a positive alert count to a priority", threshold, priority, rc.Name)
+			}
+		}
+		switch rc.LabelFormat {
+		case "":
+			rc.LabelFormat = LabelFormatKeyValue
+		case LabelFormatKeyValue, LabelFormatValue:
+		default:
+			return fmt.Errorf("invalid label_format %q in receiver %q, must be %q or %q", rc.LabelFormat, rc.Name, LabelFormatKeyValue, LabelFormatValue)
+		}
+		if rc.TagReceiver && rc.ReceiverLabelKey == "" {
+			rc.ReceiverLabelKey = "receiver"
+		}
+		if rc.AnnotationPrefix == "" {
+			rc.AnnotationPrefix = "jira_"
+		}
+		if rc.SummaryCountThreshold < 0 {
+			return fmt.Errorf("negative summary_count_threshold in receiver %q", rc.Name)
+		}
+		if strings.ContainsAny(rc.DedupLabelPrefix, " \t\n") {
+			return fmt.Errorf("invalid dedup_label_prefix %q in receiver %q, must not contain whitespace", rc.DedupLabelPrefix, rc.Name)
+		}
+		if rc.DedupField != "" && !customFieldRE.MatchString(rc.DedupField) {
+			return fmt.Errorf("invalid dedup_field %q in receiver %q, must be a custom field id like customfield_10000", rc.DedupField, rc.Name)
+		}
+		switch rc.LabelOverflow {
+		case "":
+			rc.LabelOverflow = LabelOverflowTruncate
+		case LabelOverflowTruncate, LabelOverflowDrop:
+		default:
+			return fmt.Errorf("invalid label_overflow %q in receiver %q, must be %q or %q", rc.LabelOverflow, rc.Name, LabelOverflowTruncate, LabelOverflowDrop)
+		}
+		if len(rc.Delims) > 0 && (len(rc.Delims) != 2 || rc.Delims[0] == "" || rc.Delims[1] == "" || rc.Delims[0] == rc.Delims[1]) {
+			return fmt.Errorf("invalid delims %q in receiver %q, must be two distinct non-empty strings", rc.Delims, rc.Name)
+		}
+		if rc.MaxDescriptionChars < 0 {
+			return fmt.Errorf("negative max_description_chars in receiver %q", rc.Name)
+		}
+		if rc.MaxAlertsInDescription < 0 {
+			return fmt.Errorf("negative max_alerts_in_description in receiver %q", rc.Name)
 		}
 	}
 
 	if len(c.Receivers) == 0 {
 		return fmt.Errorf("no receivers defined")
 	}
+	// ReceiverByName would silently pick the first of receivers sharing a name.
+	names := map[string]int{}
+	var duplicates []string
+	for _, rc := range c.Receivers {
+		if names[rc.Name]++; names[rc.Name] == 2 {
+			duplicates = append(duplicates, fmt.Sprintf("%q", rc.Name))
+		}
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("duplicate receiver names: %s", strings.Join(duplicates, ", "))
+	}
+	for _, rc := range c.Receivers {
+		if rc.ResolvedReceiver == "" {
+			continue
+		}
+		if rc.ResolvedReceiver == rc.Name {
+			return fmt.Errorf("resolved_receiver of receiver %q must be another receiver", rc.Name)
+		}
+		if target := c.ReceiverByName(rc.ResolvedReceiver); target == nil || target.Name != rc.ResolvedReceiver {
+			return fmt.Errorf("unknown resolved_receiver %q in receiver %q", rc.ResolvedReceiver, rc.Name)
+		}
+	}
 
-	if c.Template == "" {
-		return fmt.Errorf("missing template file")
+	apiURLs := map[string]bool{}
+	for _, rc := range c.Receivers {
+		apiURLs[rc.APIURL] = true
+	}
+	for apiURL, limit := range c.JiraConcurrency {
+		if !apiURLs[apiURL] {
+			return fmt.Errorf("jira_concurrency for %q, which is the api_url of no receiver", apiURL)
+		}
+		if limit <= 0 {
+			return fmt.Errorf("non-positive jira_concurrency for %q", apiURL)
+		}
 	}
 
 	return checkOverflow(c.XXX, "config")
 }
 
-// ReceiverByName loops the receiver list and returns the first instance with that name
+// TemplateFiles returns the template_file of each receiver that has one, keyed by receiver name.
+func (c *Config) TemplateFiles() map[string]string {
+	files := map[string]string{}
+	for _, rc := range c.Receivers {
+		if rc.TemplateFile != "" {
+			files[rc.Name] = rc.TemplateFile
+		}
+	}
+	return files
+}
+
+// TemplateDelims returns the delims of each receiver that has them, keyed by receiver name.
+func (c *Config) TemplateDelims() map[string][2]string {
+	delims := map[string][2]string{}
+	for _, rc := range c.Receivers {
+		if len(rc.Delims) == 2 {
+			delims[rc.Name] = [2]string{rc.Delims[0], rc.Delims[1]}
+		}
+	}
+	return delims
+}
+
+// KeepEmptyField returns whether the field with the given name is to be submitted even if it renders empty.
+func (rc *ReceiverConfig) KeepEmptyField(name string) bool {
+	for _, f := range rc.KeepEmptyFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// NumericField returns whether the field with the given name is to be submitted as a number.
+func (rc *ReceiverConfig) NumericField(name string) bool {
+	for _, f := range rc.NumericFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ReceiverByName loops the receiver list and returns the first instance with that name, falling back to the most
+// specific receiver whose wildcard name matches.
 func (c *Config) ReceiverByName(name string) *ReceiverConfig {
+	rc, _ := c.ReceiverMatch(name)
+	return rc
+}
+
+// ReceiverMatch is like ReceiverByName, but also returns the parts of name matched by the wildcards of the receiver
+// returned, if any. Among wildcard receivers the one with the most literal characters wins, then the first defined.
+func (c *Config) ReceiverMatch(name string) (*ReceiverConfig, []string) {
 	for _, rc := range c.Receivers {
 		if rc.Name == name {
-			return rc
+			return rc, nil
 		}
 	}
-	return nil
+
+	var (
+		best        *ReceiverConfig
+		bestMatches []string
+		bestLen     = -1
+	)
+	for _, rc := range c.Receivers {
+		if rc.namePattern == nil {
+			continue
+		}
+		m := rc.namePattern.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+		if literal := len(strings.Replace(rc.Name, "*", "", -1)); literal > bestLen {
+			best, bestMatches, bestLen = rc, m[1:], literal
+		}
+	}
+	return best, bestMatches
 }
 
 func checkOverflow(m map[string]interface{}, ctx string) error {
@@ -335,6 +1175,10 @@ func (d Duration) MarshalYAML() (interface{}, error) {
 	return d.String(), nil
 }
 
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
 func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	var s string
 	if err := unmarshal(&s); err != nil {
@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 )
 
 const testConf = `
@@ -77,3 +79,192 @@ func TestLoadFile(t *testing.T) {
 
 	// TODO(bwplotka): Add proper test cases on config struct.
 }
+
+func TestConfigJSONRedactsSecrets(t *testing.T) {
+	cfg, err := Load(testConf)
+	require.NoError(t, err)
+
+	b, err := cfg.JSON()
+	require.NoError(t, err)
+	require.NotContains(t, string(b), "JIRAlert")
+	require.Contains(t, string(b), `"password": "<secret>"`)
+	require.Contains(t, string(b), `"reopen_duration": "0s"`)
+
+	cfg, err = Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    jira_headers: { X-Corp-Token: s3cr3t }\n", 1))
+	require.NoError(t, err)
+	b, err = cfg.JSON()
+	require.NoError(t, err)
+	require.NotContains(t, string(b), "s3cr3t")
+	require.Contains(t, string(b), `"X-Corp-Token": "<secret>"`)
+}
+
+func TestAPIVersion(t *testing.T) {
+	cfg, err := Load(testConf)
+	require.NoError(t, err)
+	for _, rc := range cfg.Receivers {
+		require.Equal(t, "2", rc.APIVersion)
+	}
+
+	_, err = Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    api_version: '4'\n", 1))
+	require.EqualError(t, err, `unsupported api_version "4" in receiver "jira-xy", must be "2" or "3"`)
+}
+
+func TestJiraClientCertificate(t *testing.T) {
+	_, err := Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    jira_client_cert_file: client.crt\n    jira_client_key_file: client.key\n", 1))
+	require.NoError(t, err)
+
+	_, err = Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    jira_client_cert_file: client.crt\n", 1))
+	require.EqualError(t, err, `jira_client_cert_file and jira_client_key_file must be set together in receiver "jira-xy"`)
+}
+
+func TestTimezone(t *testing.T) {
+	cfg, err := Load(testConf)
+	require.NoError(t, err)
+	require.Equal(t, time.UTC, cfg.Receivers[0].Location())
+
+	cfg, err = Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    timezone: Europe/Istanbul\n", 1))
+	require.NoError(t, err)
+	require.Equal(t, "Europe/Istanbul", cfg.Receivers[1].Location().String())
+
+	_, err = Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    timezone: Mars/Olympus\n", 1))
+	require.Error(t, err)
+}
+
+func TestReceiverMatch(t *testing.T) {
+	cfg, err := Load(strings.Replace(testConf, "\n# File containing template definitions.", `
+  - name: 'team-*'
+    project: TEAM
+  - name: 'team-pay*'
+    project: PAY
+# File containing template definitions.`, 1))
+	require.NoError(t, err)
+
+	rc, matches := cfg.ReceiverMatch("jira-ab")
+	require.Equal(t, "jira-ab", rc.Name)
+	require.Nil(t, matches)
+
+	rc, matches = cfg.ReceiverMatch("team-payments")
+	require.Equal(t, "team-pay*", rc.Name)
+	require.Equal(t, []string{"ments"}, matches)
+
+	rc, matches = cfg.ReceiverMatch("team-search")
+	require.Equal(t, "team-*", rc.Name)
+	require.Equal(t, []string{"search"}, matches)
+
+	require.Nil(t, cfg.ReceiverByName("other"))
+}
+
+func TestCommentVisibility(t *testing.T) {
+	cfg, err := Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    comment_visibility: {type: role, value: Developers}\n", 1))
+	require.NoError(t, err)
+	require.Equal(t, &CommentVisibility{Type: "role", Value: "Developers"}, cfg.Receivers[1].CommentVisibility)
+
+	_, err = Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    comment_visibility: {type: user, value: jiralert}\n", 1))
+	require.EqualError(t, err, `invalid comment_visibility type "user", must be "role" or "group"`)
+}
+
+func TestActiveTimeIntervals(t *testing.T) {
+	cfg, err := Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", `  - name: 'jira-xy'
+    timezone: Europe/Istanbul
+    active_time_intervals:
+      - weekdays: [ "monday:friday" ]
+        times:
+          - start_time: "09:00"
+            end_time: "17:00"
+      - weekdays: [ "saturday" ]
+        location: UTC
+`, 1))
+	require.NoError(t, err)
+	rc := cfg.ReceiverByName("jira-xy")
+
+	// 2021-03-01 is a Monday, Istanbul is at UTC+3.
+	require.True(t, rc.ActiveAt(time.Date(2021, 3, 1, 6, 0, 0, 0, time.UTC)))
+	require.False(t, rc.ActiveAt(time.Date(2021, 3, 1, 14, 0, 0, 0, time.UTC)))
+	require.True(t, rc.ActiveAt(time.Date(2021, 3, 6, 23, 30, 0, 0, time.UTC)))
+	require.False(t, rc.ActiveAt(time.Date(2021, 3, 7, 10, 0, 0, 0, time.UTC)))
+	require.True(t, cfg.ReceiverByName("jira-ab").ActiveAt(time.Date(2021, 3, 7, 10, 0, 0, 0, time.UTC)))
+
+	_, err = Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    active_time_intervals: [ { weekdays: [ someday ] } ]\n", 1))
+	require.Error(t, err)
+	_, err = Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    active_time_intervals: [ { times: [ { start_time: '17:00', end_time: '09:00' } ] } ]\n", 1))
+	require.Error(t, err)
+}
+
+func TestDefaultsMerge(t *testing.T) {
+	conf := strings.Replace(testConf, "  reopen_duration: 0h\n", `  reopen_duration: 0h
+  components: [ 'Platform' ]
+  labels: [ 'alerting' ]
+  add_group_labels: true
+  max_labels: 10
+  resolved_receiver: 'jira-ab'
+`, 1)
+	conf = strings.Replace(conf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    labels: []\n    max_labels: 0\n", 1)
+	cfg, err := Load(conf)
+	require.NoError(t, err)
+
+	ab, xy := cfg.ReceiverByName("jira-ab"), cfg.ReceiverByName("jira-xy")
+	require.Equal(t, "Critical", ab.Priority)
+	require.Equal(t, []string{"Platform"}, ab.Components)
+	require.Equal(t, []string{"alerting"}, ab.Labels)
+	require.Equal(t, 10, ab.MaxLabels)
+	// Set to false explicitly, overriding the default.
+	require.False(t, ab.AddGroupLabels)
+
+	require.Equal(t, "Task", xy.IssueType)
+	require.Equal(t, []string{"Operations"}, xy.Components)
+	require.Empty(t, xy.Labels)
+	require.Equal(t, 0, xy.MaxLabels)
+	require.True(t, xy.AddGroupLabels)
+	require.Equal(t, "Random text", xy.Fields["customfield_10001"])
+
+	// Never inherited.
+	require.Empty(t, ab.ResolvedReceiver)
+	require.Empty(t, xy.ResolvedReceiver)
+
+	// Without defaults, receivers must set the required options themselves.
+	_, err = Load("receivers:\n  - name: jira-ab\n    project: AB\n")
+	require.EqualError(t, err, `missing api_url in receiver "jira-ab"`)
+}
+
+func TestStatusTransitions(t *testing.T) {
+	cfg, err := Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    status_transitions: { firing: Acknowledge, resolved: Resolve }\n", 1))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"firing": "Acknowledge", "resolved": "Resolve"}, cfg.ReceiverByName("jira-xy").StatusTransitions)
+
+	_, err = Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    status_transitions: { pending: Triage }\n", 1))
+	require.EqualError(t, err, `invalid status_transitions status "pending" in receiver "jira-xy", must be "firing" or "resolved"`)
+}
+
+func TestDigestPeriodStart(t *testing.T) {
+	cfg, err := Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    timezone: Europe/Istanbul\n    digest: { rollover: '09:00' }\n", 1))
+	require.NoError(t, err)
+	rc := cfg.ReceiverByName("jira-xy")
+
+	// Istanbul is at UTC+3, so the day starts at 06:00 UTC.
+	start := rc.Digest.PeriodStart(time.Date(2021, 3, 1, 7, 0, 0, 0, time.UTC), rc.Location())
+	require.Equal(t, "2021-03-01 09:00", start.Format("2006-01-02 15:04"))
+	start = rc.Digest.PeriodStart(time.Date(2021, 3, 1, 5, 59, 0, 0, time.UTC), rc.Location())
+	require.Equal(t, "2021-02-28 09:00", start.Format("2006-01-02 15:04"))
+
+	_, err = Load(strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-xy'\n    digest: { rollover: '9am' }\n", 1))
+	require.Error(t, err)
+}
+
+func TestDuplicateReceiverNames(t *testing.T) {
+	conf := strings.Replace(testConf, "  - name: 'jira-xy'\n", "  - name: 'jira-ab'\n    project: CD\n\n  - name: 'jira-xy'\n", 1)
+	conf = strings.Replace(conf, "\n# File containing template definitions.", "\n  - name: 'jira-xy'\n    project: EF\n\n  - name: 'jira-xy'\n    project: GH\n\n# File containing template definitions.", 1)
+	_, err := Load(conf)
+	require.Error(t, err)
+	require.Equal(t, `duplicate receiver names: "jira-ab", "jira-xy"`, err.Error())
+}
+
+func TestJiraConcurrency(t *testing.T) {
+	cfg, err := Load(testConf + "jira_concurrency:\n  https://jiralert.atlassian.net: 5\n")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"https://jiralert.atlassian.net": 5}, cfg.JiraConcurrency)
+
+	_, err = Load(testConf + "jira_concurrency:\n  https://jira.example.com: 5\n")
+	require.Error(t, err)
+	_, err = Load(testConf + "jira_concurrency:\n  https://jiralert.atlassian.net: 0\n")
+	require.Error(t, err)
+}
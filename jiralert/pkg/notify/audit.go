@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Actions recorded in the audit log.
+const (
+	auditCreate  = "create"
+	auditUpdate  = "update"
+	auditReopen  = "reopen"
+	auditResolve = "resolve"
+)
+
+// AuditLog, if not nil, records every issue created, updated, reopened or resolved by any receiver.
+var AuditLog *AuditWriter
+
+// AuditWriter writes audit records as JSON lines. It is safe for concurrent use.
+type AuditWriter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	fsync bool
+}
+
+// NewAuditWriter returns an AuditWriter writing to w. If fsync is set and w is a file, every record is synced to disk
+// before Notify goes on.
+func NewAuditWriter(w io.Writer, fsync bool) *AuditWriter {
+	return &AuditWriter{w: w, fsync: fsync}
+}
+
+// auditRecord is a line of the audit log.
+type auditRecord struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Receiver string    `json:"receiver"`
+	GroupKey string    `json:"groupKey"`
+	IssueKey string    `json:"issueKey"`
+}
+
+// write appends a record to the log.
+func (a *AuditWriter) write(rec auditRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if f, ok := a.w.(*os.File); ok && a.fsync {
+		return f.Sync()
+	}
+	return nil
+}
+
+// audit records an action of the receiver on the issue of the alert group, if AuditLog is set. Failing to is logged
+// and counted, but doesn't fail the notification: the action has been taken in JIRA already.
+func (r *Receiver) audit(action string, data *alertmanager.Data, issueKey string, logger log.Logger) {
+	if AuditLog == nil {
+		return
+	}
+	rec := auditRecord{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		Receiver: r.conf.Name,
+		GroupKey: data.GroupKey,
+		IssueKey: issueKey,
+	}
+	if err := AuditLog.write(rec); err != nil {
+		level.Error(logger).Log("msg", "failed to write audit log", "action", action, "key", issueKey, "err", err)
+		auditErrorsTotal.Inc()
+	}
+}
@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Defaults of ConfigureDedupCache.
+const (
+	// recentCacheSize bounds the number of alert groups remembered as recently created.
+	recentCacheSize = 1000
+	// recentCacheTTL is how long an alert group is remembered, comfortably longer than typical dedup grace periods.
+	recentCacheTTL = time.Hour
+)
+
+// recentEntry records an issue created for an alert group.
+type recentEntry struct {
+	key      string
+	issueKey string
+	created  time.Time
+}
+
+// recentCache is a least recently used cache of the alert groups issues were created for, used to bridge the delay
+// before JIRA's search index covers a newly created issue. Entries expire ttl after the issue was created.
+type recentCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newRecentCache(size int, ttl time.Duration) *recentCache {
+	return &recentCache{size: size, ttl: ttl, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// recentlyCreated holds the alert groups, keyed by receiver and issue label, issues were created for.
+var recentlyCreated = newRecentCache(recentCacheSize, recentCacheTTL)
+
+// ConfigureDedupCache sets the maximum number of alert groups remembered as recently created, for dedup_grace, and
+// for how long. Meant to be called once, before any notification.
+func ConfigureDedupCache(size int, ttl time.Duration) {
+	recentlyCreated = newRecentCache(size, ttl)
+	dedupCacheEntries.Set(0)
+}
+
+// Add records that issueKey was created for the alert group key, dropping expired entries and evicting the least
+// recently used one if full.
+func (c *recentCache) Add(key, issueKey string, created time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer func() { dedupCacheEntries.Set(float64(c.order.Len())) }()
+
+	c.prune(created)
+	if e, ok := c.entries[key]; ok {
+		e.Value = &recentEntry{key: key, issueKey: issueKey, created: created}
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&recentEntry{key: key, issueKey: issueKey, created: created})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Get returns the entry for the alert group key, if any and not expired at now.
+func (c *recentCache) Get(key string, now time.Time) (*recentEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if c.expired(e, now) {
+		c.remove(e)
+		dedupCacheEntries.Set(float64(c.order.Len()))
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*recentEntry), true
+}
+
+// prune drops the entries expired at now. As recently used entries need not be recently created, it scans them all,
+// which the size bound keeps cheap.
+func (c *recentCache) prune(now time.Time) {
+	for e := c.order.Back(); e != nil; {
+		prev := e.Prev()
+		if c.expired(e, now) {
+			c.remove(e)
+		}
+		e = prev
+	}
+}
+
+func (c *recentCache) expired(e *list.Element, now time.Time) bool {
+	return c.ttl > 0 && now.Sub(e.Value.(*recentEntry).created) >= c.ttl
+}
+
+func (c *recentCache) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*recentEntry).key)
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"sync"
+)
+
+// slots limits the number of notifications handled concurrently per JIRA instance, keyed by API URL. Instances
+// without a limit of their own get the global one, if any.
+var slots = struct {
+	sync.Mutex
+	global    int
+	instances map[string]int
+	sems      map[string]chan struct{}
+}{sems: map[string]chan struct{}{}}
+
+// ConfigureConcurrency sets the maximum number of notifications handled concurrently per JIRA instance: perInstance,
+// keyed by API URL, or global for the others (0 meaning no limit). Meant to be called once, before any notification.
+func ConfigureConcurrency(global int, perInstance map[string]int) {
+	slots.Lock()
+	defer slots.Unlock()
+	slots.global, slots.instances = global, perInstance
+	slots.sems = map[string]chan struct{}{}
+}
+
+// acquireSlot waits for a free slot of the JIRA instance, at most until ctx is done. The returned function releases
+// the slot; it must be called even if there is no limit, for jiraInFlight to stay accurate.
+func acquireSlot(ctx context.Context, apiURL string) (func(), error) {
+	slots.Lock()
+	sem, ok := slots.sems[apiURL]
+	if !ok {
+		limit, ok := slots.instances[apiURL]
+		if !ok {
+			limit = slots.global
+		}
+		if limit > 0 {
+			sem = make(chan struct{}, limit)
+		}
+		slots.sems[apiURL] = sem
+	}
+	slots.Unlock()
+
+	if sem != nil {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return func() {}, ctx.Err()
+		}
+	}
+	jiraInFlight.WithLabelValues(apiURL).Inc()
+	return func() {
+		jiraInFlight.WithLabelValues(apiURL).Dec()
+		if sem != nil {
+			<-sem
+		}
+	}, nil
+}
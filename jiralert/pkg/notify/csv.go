@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"encoding/csv"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+)
+
+// alertsCSVAttachment is the name of the attachment listing the alerts of the group, see ReceiverConfig.AttachCSV.
+const alertsCSVAttachment = "alerts.csv"
+
+// alertsCSV renders the alerts as CSV, one row per alert. The columns are status, startsAt, endsAt and fingerprint,
+// followed by the common labels and then by the labels that tell the alerts apart, each set sorted by name. An alert
+// lacking one of the latter has an empty cell.
+func alertsCSV(data *alertmanager.Data) (string, error) {
+	common := data.CommonLabels.Names()
+
+	seen := map[string]bool{}
+	for _, name := range common {
+		seen[name] = true
+	}
+	var distinct []string
+	for _, a := range data.Alerts {
+		for name := range a.Labels {
+			if !seen[name] {
+				seen[name] = true
+				distinct = append(distinct, name)
+			}
+		}
+	}
+	sort.Strings(distinct)
+	labels := append(common, distinct...)
+
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	if err := w.Write(append([]string{"status", "startsAt", "endsAt", "fingerprint"}, labels...)); err != nil {
+		return "", err
+	}
+	for _, a := range data.Alerts {
+		row := []string{a.Status, formatCSVTime(a.StartsAt), formatCSVTime(a.EndsAt), a.Fingerprint}
+		for _, name := range labels {
+			row = append(row, a.Labels[name])
+		}
+		if err := w.Write(row); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return b.String(), w.Error()
+}
+
+// formatCSVTime formats t as RFC 3339, leaving the zero time (e.g. the end of a firing alert) empty.
+func formatCSVTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/config"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// notifyDigest comments the alert group on the receiver's digest issue of the current day, creating the issue first
+// if this is the day's first notification.
+func (r *Receiver) notifyDigest(project string, data *alertmanager.Data, logger log.Logger) (bool, error) {
+	date := r.conf.Digest.PeriodStart(time.Now(), r.conf.Location()).Format("2006-01-02")
+	digestLabel := sanitizeLabel(fmt.Sprintf("JIRALERT_DIGEST_%s_%s", r.conf.Name, date))
+
+	description, ok := r.annotationContent(r.conf.Description, defaultDescriptionTemplate, "description", data)
+	if !ok {
+		description = r.tmpl.Execute(r.conf.Description, data, logger)
+	}
+	body := "*" + r.renderSummary(data, logger) + "*\n\n" + description
+	if err := r.tmpl.Err(); err != nil {
+		return false, &NotifyError{ErrorValidation, err}
+	}
+	if r.conf.DescriptionFormat == config.DescriptionFormatMarkdown {
+		body = markdownToWiki(body)
+	}
+
+	unlock, ok := r.lockGroup(digestLabel, logger)
+	defer unlock()
+	if !ok {
+		// Comments are per notification: leaving this one to the replica holding the lock would drop it.
+		return true, &NotifyError{ErrorTransient, fmt.Errorf("digest issue %s is being handled by another replica", digestLabel)}
+	}
+	// The label names the day, so an issue remembered as created for it is the day's digest issue, however long ago
+	// it was created. This bridges JIRA's search index lagging behind even without dedup_grace.
+	issue, issueKey, retry, err := r.searchRecent(project, digestLabel, 24*time.Hour, logger)
+	if err != nil {
+		return retry, err
+	}
+	if issue != nil {
+		issueKey = issue.Key
+	}
+	if issueKey == "" {
+		issue, err = r.renderDigest(data, digestLabel, date, logger)
+		if err != nil {
+			return false, err
+		}
+		if retry, err := r.prepareCreate(issue, data, logger); err != nil {
+			return retry, err
+		}
+		if retry, err := r.create(issue, logger); err != nil {
+			return retry, err
+		}
+		level.Info(logger).Log("msg", "digest issue created", "key", issue.Key, "label", digestLabel)
+		issuesCreatedTotal.WithLabelValues(r.conf.Name, projectLabel(project)).Inc()
+		r.audit(auditCreate, data, issue.Key, logger)
+		recentlyCreated.Add(r.conf.Name+"|"+digestLabel, issue.Key, time.Now())
+		issueKey = issue.Key
+	}
+	r.issueKey = issueKey
+
+	level.Debug(logger).Log("msg", "adding alert group to digest issue", "key", issueKey, "label", digestLabel)
+	retry, err = r.addComment(issueKey, body, logger)
+	if err == nil {
+		r.audit(auditUpdate, data, issueKey, logger)
+	}
+	return retry, err
+}
+
+// renderDigest builds the digest issue of the day. It takes the receiver's issue type, priority, components and
+// fields from the day's first alert group, but none of the group's labels.
+func (r *Receiver) renderDigest(data *alertmanager.Data, digestLabel, date string, logger log.Logger) (*jira.Issue, error) {
+	summary := r.conf.Digest.Summary
+	if summary == "" {
+		summary = "JIRAlert digest " + r.conf.Name
+	}
+	description := fmt.Sprintf("Alert groups notified to JIRAlert receiver %s on the day starting %s, one comment each.", r.conf.Name, date)
+
+	issue, _, err := r.render(data, logger)
+	if err != nil {
+		return nil, err
+	}
+	issue.Fields.Summary = truncateRunes(summary+" "+date, maxSummaryLength, "")
+	issue.Fields.Labels = append([]string{digestLabel}, r.staticLabels()...)
+	if l := r.receiverLabel(); l != "" {
+		issue.Fields.Labels = append(issue.Fields.Labels, l)
+	}
+	issue.Fields.Description = description
+	if r.conf.APIVersion == "3" {
+		// API v3 only accepts descriptions in Atlassian Document Format.
+		issue.Fields.Description = ""
+		issue.Fields.Unknowns["description"] = toADF(description)
+	}
+	return issue, nil
+}
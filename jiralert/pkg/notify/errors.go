@@ -0,0 +1,74 @@
+package notify
+
+import "errors"
+
+// ErrorKind classifies why a notification failed.
+type ErrorKind int
+
+// Kinds of NotifyError.
+const (
+	ErrorUnknown ErrorKind = iota
+	// JIRA rejected the credentials.
+	ErrorAuth
+	// JIRA throttled the request.
+	ErrorRateLimit
+	// A template failed or JIRA rejected the request as invalid, a retry won't help.
+	ErrorValidation
+	// JIRA failed with a server error, a retry may succeed.
+	ErrorTransient
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorAuth:
+		return "auth"
+	case ErrorRateLimit:
+		return "rate_limit"
+	case ErrorValidation:
+		return "validation"
+	case ErrorTransient:
+		return "transient"
+	default:
+		return "unknown"
+	}
+}
+
+// NotifyError is an error returned by Receiver.Notify, classified by kind.
+type NotifyError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *NotifyError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *NotifyError) Unwrap() error {
+	return e.Err
+}
+
+// notFoundError is returned by JIRA requests answered with 404 Not Found, e.g. about a deleted issue.
+type notFoundError struct {
+	error
+}
+
+// Unwrap returns the underlying error.
+func (e *notFoundError) Unwrap() error {
+	return e.error
+}
+
+// isNotFound reports whether err is or wraps a notFoundError.
+func isNotFound(err error) bool {
+	var nf *notFoundError
+	return errors.As(err, &nf)
+}
+
+// ErrorKindOf returns the kind of err, ErrorUnknown unless it is or wraps a NotifyError.
+func ErrorKindOf(err error) ErrorKind {
+	var ne *NotifyError
+	if errors.As(err, &ne) {
+		return ne.Kind
+	}
+	return ErrorUnknown
+}
@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/trivago/tgo/tcontainer"
+)
+
+// fallbackLabel marks the issues created by createFallback.
+const fallbackLabel = "JIRALERT_TEMPLATE_ERROR"
+
+// createFallback creates a minimal issue for the alert group after its issue failed to render, see
+// ReceiverConfig.TemplateErrorFallback. It uses no templates: the summary names the group labels and the description
+// holds the rendering error and the raw alert data. The issue carries the dedup key, so later notifications find it,
+// plus fallbackLabel and the static labels. None of the steps following creation are performed.
+func (r *Receiver) createFallback(project, issueLabel string, data *alertmanager.Data, renderErr error, logger log.Logger) (bool, error) {
+	left := r.conf.LeftDelim()
+	if strings.Contains(r.conf.IssueType, left) || strings.Contains(r.conf.IssueTypeID, left) {
+		level.Error(logger).Log("msg", "can't create fallback issue with a templated issue type", "label", issueLabel)
+		return false, renderErr
+	}
+	level.Error(logger).Log("msg", "failed to render issue from templates, creating fallback issue", "label", issueLabel, "err", renderErr)
+
+	alerts, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	summary := fmt.Sprintf("[%s] JIRAlert template error: %s", strings.ToUpper(data.Status), strings.Join(data.GroupLabels.Values(), " "))
+	description := fmt.Sprintf("JIRAlert failed to render this issue from the templates of receiver %s, so it was created without them.\n\nError: %s\n\nAlert data:\n%s",
+		r.conf.Name, renderErr, alerts)
+	if r.conf.MaxDescriptionChars > 0 {
+		description = truncateRunes(description, r.conf.MaxDescriptionChars, "\n\n[...] Description truncated.")
+	}
+	issue := &jira.Issue{
+		Fields: &jira.IssueFields{
+			Project:     jira.Project{Key: project},
+			Type:        jira.IssueType{ID: r.conf.IssueTypeID, Name: r.conf.IssueType},
+			Summary:     truncateRunes(summary, maxSummaryLength, ""),
+			Description: description,
+			Labels:      append([]string{fallbackLabel}, r.staticLabels()...),
+			Unknowns:    tcontainer.NewMarshalMap(),
+		},
+	}
+	if r.conf.IssueTypeID != "" {
+		issue.Fields.Type.Name = ""
+	}
+	if r.conf.DedupField != "" {
+		issue.Fields.Unknowns[r.conf.DedupField] = issueLabel
+	} else {
+		issue.Fields.Labels = append(issue.Fields.Labels, issueLabel)
+	}
+	if r.conf.APIVersion == "3" {
+		// API v3 only accepts descriptions in Atlassian Document Format.
+		issue.Fields.Description = ""
+		issue.Fields.Unknowns["description"] = toADF(description)
+	}
+
+	if retry, err := r.create(issue, logger); err != nil {
+		return retry, err
+	}
+	level.Warn(logger).Log("msg", "fallback issue created", "key", issue.Key, "label", issueLabel)
+	r.issueKey = issue.Key
+	issuesCreatedTotal.WithLabelValues(r.conf.Name, projectLabel(project)).Inc()
+	fallbackIssuesTotal.WithLabelValues(r.conf.Name).Inc()
+	recentlyCreated.Add(r.conf.Name+"|"+issueLabel, issue.Key, time.Now())
+	r.audit(auditCreate, data, issue.Key, logger)
+	return false, nil
+}
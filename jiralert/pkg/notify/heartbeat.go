@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"sync"
+	"time"
+
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// lastHeartbeats holds until when ReceiverConfig.HeartbeatComment isn't added again, by receiver and issue key. It only
+// lives in memory: after a restart, the first notification of every issue is commented again.
+var lastHeartbeats = struct {
+	sync.Mutex
+	expires map[string]time.Time
+}{expires: map[string]time.Time{}}
+
+// heartbeat adds the heartbeat comment to the unresolved issue, unless it was added less than HeartbeatInterval ago.
+func (r *Receiver) heartbeat(issueKey string, data *alertmanager.Data, now time.Time, logger log.Logger) (bool, error) {
+	key := r.conf.Name + "|" + issueKey
+	lastHeartbeats.Lock()
+	for k, expires := range lastHeartbeats.expires {
+		if !now.Before(expires) {
+			delete(lastHeartbeats.expires, k)
+		}
+	}
+	_, recent := lastHeartbeats.expires[key]
+	lastHeartbeats.Unlock()
+	if recent {
+		return false, nil
+	}
+
+	body := r.tmpl.Execute(r.conf.HeartbeatComment, data, logger)
+	if err := r.tmpl.Err(); err != nil {
+		return false, &NotifyError{ErrorValidation, err}
+	}
+	if body == "" {
+		return false, nil
+	}
+	level.Debug(logger).Log("msg", "adding heartbeat comment", "key", issueKey)
+	if retry, err := r.addComment(issueKey, body, logger); err != nil {
+		return retry, err
+	}
+	lastHeartbeats.Lock()
+	lastHeartbeats.expires[key] = now.Add(time.Duration(*r.conf.HeartbeatInterval))
+	lastHeartbeats.Unlock()
+	return false, nil
+}
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/config"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// maxImageBytes bounds the size of images fetched for attach_image. Rendered panels are typically well below 1 MiB.
+const maxImageBytes = 10 << 20
+
+// attachImage fetches the receiver's attach_image and attaches it to the issue.
+func (r *Receiver) attachImage(issueKey string, data *alertmanager.Data, logger log.Logger) error {
+	ai := r.conf.AttachImage
+	u := r.tmpl.Execute(ai.URL, data, logger)
+	if err := r.tmpl.Err(); err != nil {
+		return err
+	}
+	image, err := fetchImage(u, ai.Headers, time.Duration(*ai.Timeout), logger)
+	if err != nil {
+		return err
+	}
+	_, err = r.attach(issueKey, ai.Filename, image, logger)
+	return err
+}
+
+// fetchImage gets the image at u, failing unless it is served as an image of at most maxImageBytes.
+func fetchImage(u string, headers map[string]config.Secret, timeout time.Duration, logger log.Logger) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "image/*")
+	for name, value := range headers {
+		req.Header.Set(name, string(value))
+	}
+	level.Debug(logger).Log("msg", "fetching image", "url", u)
+	client := http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return "", fmt.Errorf("fetching image %s failed: %s", u, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("fetching image %s returned status %s", u, resp.Status)
+	}
+	// E.g. a login page, if the request isn't authorized.
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "image/") {
+		return "", fmt.Errorf("fetching image %s returned content type %q, not an image", u, ct)
+	}
+	body, err := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: maxImageBytes + 1})
+	if err != nil {
+		return "", fmt.Errorf("fetching image %s failed: %s", u, err)
+	}
+	if len(body) > maxImageBytes {
+		return "", fmt.Errorf("image %s exceeds %d bytes", u, maxImageBytes)
+	}
+	return string(body), nil
+}
@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// jqlParseResult is the response of JIRA's jql/parse endpoint.
+type jqlParseResult struct {
+	Queries []struct {
+		Query    string   `json:"query"`
+		Errors   []string `json:"errors"`
+		Warnings []string `json:"warnings"`
+	} `json:"queries"`
+}
+
+// ValidateJQL checks that the receiver's precondition JQL, rendered without alert data, is valid JQL. It asks JIRA's
+// jql/parse endpoint, treating references to unknown fields or values as warnings since they may depend on alert data.
+// Where the endpoint doesn't exist, as in older JIRA Server versions, the query is searched instead.
+func (r *Receiver) ValidateJQL(logger log.Logger) error {
+	if r.conf.PreconditionJQL == "" {
+		return nil
+	}
+	query := strings.TrimSpace(r.tmpl.Execute(r.conf.PreconditionJQL, &alertmanager.Data{}, logger))
+	if err := r.tmpl.Err(); err != nil {
+		return fmt.Errorf("precondition_jql: %s", err)
+	}
+
+	level.Debug(logger).Log("msg", "validating JQL", "query", query)
+	req, err := r.client.NewRequest("POST", "rest/api/2/jql/parse?validation=warn", map[string][]string{"queries": {query}})
+	if err != nil {
+		return err
+	}
+	result := &jqlParseResult{}
+	resp, err := r.client.Do(req, result)
+	if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound {
+		_, resp, err = r.client.Issue.Search(query, &jira.SearchOptions{Fields: []string{"summary"}, MaxResults: 1})
+		if err != nil {
+			_, err = r.handleJiraError("Issue.Search", resp, err, logger)
+			return fmt.Errorf("precondition_jql %q: %s", query, err)
+		}
+		return nil
+	}
+	if err != nil {
+		_, err = r.handleJiraError("JQL.Parse", resp, err, logger)
+		return err
+	}
+	for _, q := range result.Queries {
+		if len(q.Warnings) > 0 {
+			level.Warn(logger).Log("msg", "precondition_jql may not match as intended", "query", q.Query, "warnings", strings.Join(q.Warnings, "; "))
+		}
+		if len(q.Errors) > 0 {
+			return fmt.Errorf("invalid precondition_jql %q: %s", q.Query, strings.Join(q.Errors, "; "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package notify
+
+import "sync"
+
+// keyedMutex serializes callers by key. Mutexes are created on demand and dropped once no caller holds or waits for
+// them, so the set of keys does not grow without bound.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*refMutex
+}
+
+type refMutex struct {
+	sync.Mutex
+	refs int
+}
+
+// groupLocks serializes notifications for the same receiver and alert group within this process.
+var groupLocks = &keyedMutex{locks: map[string]*refMutex{}}
+
+// Lock blocks until the mutex for key is acquired and returns the function releasing it.
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	m, ok := k.locks[key]
+	if !ok {
+		m = &refMutex{}
+		k.locks[key] = m
+	}
+	m.refs++
+	k.mu.Unlock()
+
+	m.Lock()
+	return func() {
+		m.Unlock()
+		k.mu.Lock()
+		m.refs--
+		if m.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// Locker serializes notifications for the same receiver and alert group across JIRAlert replicas.
+type Locker interface {
+	// TryLock attempts to acquire the lock for key without waiting. It returns the function releasing it, or false if
+	// another replica holds the lock.
+	TryLock(key string) (release func(), ok bool, err error)
+}
+
+// ReplicaLock is the Locker used by Notify. The default serializes nothing, as a single replica needs no more than
+// groupLocks.
+var ReplicaLock Locker = noopLocker{}
+
+type noopLocker struct{}
+
+// TryLock implements the Locker interface.
+func (noopLocker) TryLock(string) (func(), bool, error) {
+	return func() {}, true, nil
+}
@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	mdHeadingRE       = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdBulletRE        = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdNumberedRE      = regexp.MustCompile(`^(\s*)[0-9]+[.)]\s+(.*)$`)
+	mdQuoteRE         = regexp.MustCompile(`^>\s?(.*)$`)
+	mdFenceRE         = regexp.MustCompile("^\\s*(```|~~~)\\s*([A-Za-z0-9_+-]*)\\s*$")
+	mdRuleRE          = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	mdCodeSpanRE      = regexp.MustCompile("`([^`]+)`")
+	mdImageRE         = regexp.MustCompile(`!\[[^\]]*\]\(([^)\s]+)\)`)
+	mdLinkRE          = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdBoldRE          = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdItalicRE        = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+	mdStrikethroughRE = regexp.MustCompile(`~~([^~]+)~~`)
+)
+
+// boldMarker temporarily stands in for the asterisks of converted bold text, so they aren't taken for italics.
+const boldMarker = "\x00"
+
+// markdownToWiki converts Markdown to JIRA wiki markup. It supports the commonly used subset: ATX headings, bulleted
+// and numbered lists (nested by indentation), fenced code blocks, block quotes, horizontal rules, links, images, code
+// spans, bold, italic and strikethrough text. Anything else is passed through unchanged.
+func markdownToWiki(md string) string {
+	lines := strings.Split(md, "\n")
+	out := make([]string, 0, len(lines))
+	inCode, fence := false, ""
+	for _, line := range lines {
+		if m := mdFenceRE.FindStringSubmatch(line); m != nil && (!inCode || m[1] == fence) {
+			switch {
+			case inCode:
+				out = append(out, "{code}")
+			case m[2] != "":
+				out = append(out, "{code:"+m[2]+"}")
+			default:
+				out = append(out, "{code}")
+			}
+			inCode, fence = !inCode, m[1]
+			continue
+		}
+		if inCode {
+			out = append(out, line)
+			continue
+		}
+
+		switch {
+		case mdHeadingRE.MatchString(line):
+			m := mdHeadingRE.FindStringSubmatch(line)
+			line = fmt.Sprintf("h%d. %s", len(m[1]), markdownInline(m[2]))
+		case mdRuleRE.MatchString(line):
+			line = "----"
+		case mdBulletRE.MatchString(line):
+			m := mdBulletRE.FindStringSubmatch(line)
+			line = strings.Repeat("*", listDepth(m[1])) + " " + markdownInline(m[2])
+		case mdNumberedRE.MatchString(line):
+			m := mdNumberedRE.FindStringSubmatch(line)
+			line = strings.Repeat("#", listDepth(m[1])) + " " + markdownInline(m[2])
+		case mdQuoteRE.MatchString(line):
+			line = "bq. " + markdownInline(mdQuoteRE.FindStringSubmatch(line)[1])
+		default:
+			line = markdownInline(line)
+		}
+		out = append(out, line)
+	}
+	if inCode {
+		// Close an unterminated code block, as Markdown renderers do at the end of the document.
+		out = append(out, "{code}")
+	}
+	return strings.Join(out, "\n")
+}
+
+// listDepth returns the nesting level of a list item indented by the given whitespace, two spaces (or a tab) per level.
+func listDepth(indent string) int {
+	width := 0
+	for _, c := range indent {
+		if c == '\t' {
+			width += 4
+		} else {
+			width++
+		}
+	}
+	return width/2 + 1
+}
+
+// markdownInline converts the inline markup of a single line. Code spans are converted verbatim.
+func markdownInline(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range mdCodeSpanRE.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(markdownEmphasis(s[last:loc[0]]))
+		b.WriteString("{{" + s[loc[2]:loc[3]] + "}}")
+		last = loc[1]
+	}
+	b.WriteString(markdownEmphasis(s[last:]))
+	return b.String()
+}
+
+func markdownEmphasis(s string) string {
+	s = mdImageRE.ReplaceAllString(s, "!$1!")
+	s = mdLinkRE.ReplaceAllString(s, "[$1|$2]")
+	s = mdBoldRE.ReplaceAllString(s, boldMarker+"$1$2"+boldMarker)
+	s = mdItalicRE.ReplaceAllString(s, "_${1}_")
+	s = mdStrikethroughRE.ReplaceAllString(s, "-$1-")
+	return strings.Replace(s, boldMarker, "*", -1)
+}
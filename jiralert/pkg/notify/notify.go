@@ -2,15 +2,23 @@ package notify
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"crypto/tls"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"io/ioutil"
 	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/config"
 	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/template"
@@ -20,53 +28,260 @@ import (
 	"github.com/trivago/tgo/tcontainer"
 )
 
+// dedupWordsRE matches the words of a dedup key, as tokenized by JIRA's text search.
+var dedupWordsRE = regexp.MustCompile(`[\pL\pN]+`)
+
+// estimateRE matches JIRA time tracking durations, e.g. "2h 30m" or "1w 2d".
+var estimateRE = regexp.MustCompile(`^\s*([0-9]+(\.[0-9]+)?[wdhm]\s*)+$`)
+
+// jsonNumberRE matches numbers as written in JSON, e.g. "-12", "2.5" or "1e6", but not "NaN", "Inf", "+5", ".5" or
+// "5.", which strconv accepts.
+var jsonNumberRE = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+const (
+	// maxLabelLength is the maximum length of a JIRA label, in characters.
+	maxLabelLength = 255
+	// maxSummaryLength is the maximum length of a JIRA issue summary, in characters.
+	maxSummaryLength = 255
+
+	// dedupSearchRetries is how many more times to search for an issue created within the dedup grace period.
+	dedupSearchRetries = 2
+	// dedupSearchRetryDelay is how long to wait before each of these searches.
+	dedupSearchRetryDelay = time.Second
+	// waitForIssueDelay is how long to wait between fetches of a created issue, see ReceiverConfig.WaitForIssue.
+	waitForIssueDelay = 500 * time.Millisecond
+)
+
+// Default summary and description templates, which the alert group's annotations take precedence over, see
+// ReceiverConfig.AnnotationPrefix.
+const (
+	defaultSummaryTemplate     = `{{ template "jira.summary" . }}`
+	defaultDescriptionTemplate = `{{ template "jira.description" . }}`
+)
+
+// fullDescriptionAttachment is the name of the attachment holding the untruncated description.
+const fullDescriptionAttachment = "description.txt"
+
+// UserAgent is the User-Agent header sent with all JIRA requests, if not empty.
+var UserAgent = "JIRAlert"
+
+// ClientCertificate is the TLS client certificate presented to JIRA by receivers without one of their own, if not nil.
+var ClientCertificate *tls.Certificate
+
+// Timeout bounds the Notify calls of receivers without a timeout of their own, if positive.
+var Timeout time.Duration
+
+// clientCertificate returns the TLS client certificate of the receiver, loaded anew every time so a renewed
+// certificate is picked up, or ClientCertificate.
+func clientCertificate(c *config.ReceiverConfig) (*tls.Certificate, error) {
+	if c.JiraClientCertFile == "" {
+		return ClientCertificate, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.JiraClientCertFile, c.JiraClientKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading JIRA client certificate of receiver %q: %s", c.Name, err)
+	}
+	return &cert, nil
+}
+
 // Receiver wraps a JIRA client corresponding to a specific Alertmanager receiver, with its configuration and templates.
 type Receiver struct {
 	conf   *config.ReceiverConfig
 	tmpl   *template.Template
 	client *jira.Client
+	// ctx is the context of the ongoing Notify call, bounding all JIRA requests. Nil if the receiver has no timeout.
+	ctx context.Context
+	// issueKey is the key of the issue the last Notify call found or created for the alert group, if any.
+	issueKey string
+	// impersonate is the user the ongoing Notify call acts as, if any.
+	impersonate string
 }
 
 // NewReceiver creates a Receiver using the provided configuration and template.
 func NewReceiver(c *config.ReceiverConfig, t *template.Template) (*Receiver, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify : true}
+	cert, err := clientCertificate(c)
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
 	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify : true},
+		TLSClientConfig: tlsConfig,
 	}
 	
+	var rt http.RoundTripper = tr
+	if c.APIVersion != "" && c.APIVersion != "2" {
+		rt = &apiVersionTransport{version: c.APIVersion, next: rt}
+	}
+	rt = &rateLimitTransport{receiver: c.Name, next: rt}
+	if UserAgent != "" {
+		rt = &userAgentTransport{userAgent: UserAgent, next: rt}
+	}
+	tmpl := t.WithLocation(c.Location())
+	if len(c.JiraHeaders) > 0 {
+		headers := make(map[string]string, len(c.JiraHeaders))
+		for name, value := range c.JiraHeaders {
+			headers[name] = tmpl.Execute(string(value), nil, log.NewNopLogger())
+		}
+		if err := tmpl.Err(); err != nil {
+			return nil, fmt.Errorf("rendering jira_headers: %s", err)
+		}
+		rt = &headerTransport{headers: headers, next: rt}
+	}
+	r := &Receiver{conf: c, tmpl: tmpl}
+	rt = &contextTransport{receiver: r, next: rt}
+	if c.ImpersonateHeader != "" {
+		rt = &impersonateTransport{receiver: r, header: c.ImpersonateHeader, next: rt}
+	}
+
 	tp := jira.BasicAuthTransport{
 		Username: c.User,
 		Password: string(c.Password),
-		Transport: tr,
+		Transport: rt,
 	}
 	client, err := jira.NewClient(tp.Client(), c.APIURL)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Receiver{conf: c, tmpl: t, client: client}, nil
+	r.client = client
+	return r, nil
+}
+
+// impersonationHint returns a note on the user impersonated by the ongoing Notify call for JIRA error messages, as
+// JIRA rejecting the request may be due to impersonation not being supported or allowed.
+func (r *Receiver) impersonationHint() string {
+	if r.impersonate == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (impersonating %q with %s, check that JIRA supports and allows it)", r.impersonate, r.conf.ImpersonateHeader)
+}
+
+// timeout returns the maximum duration of a Notify call of the receiver, or 0 if unbounded.
+func (r *Receiver) timeout() time.Duration {
+	if r.conf.Timeout != nil {
+		return time.Duration(*r.conf.Timeout)
+	}
+	return Timeout
+}
+
+// IssueKey returns the key of the issue the last Notify call found or created for the alert group, or "" if none.
+func (r *Receiver) IssueKey() string {
+	return r.issueKey
 }
 
 // Notify implements the Notifier interface.
 func (r *Receiver) Notify(data *alertmanager.Data, logger log.Logger) (bool, error) {
+	r.issueKey, r.impersonate = "", ""
+	timeout := r.timeout()
+	if timeout <= 0 {
+		release, _ := acquireSlot(context.Background(), r.conf.APIURL)
+		defer release()
+		return r.notify(data, logger)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	r.ctx = ctx
+	defer func() {
+		cancel()
+		r.ctx = nil
+	}()
+	release, err := acquireSlot(ctx, r.conf.APIURL)
+	if err != nil {
+		return true, &NotifyError{ErrorTransient, fmt.Errorf("notification timed out after %s waiting for jira_concurrency", timeout)}
+	}
+	defer release()
+
+	retry, err := r.notify(data, logger)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		// JIRA may be slow rather than down, worth retrying.
+		return true, &NotifyError{ErrorTransient, fmt.Errorf("notification timed out after %s: %s", timeout, err)}
+	}
+	return retry, err
+}
+
+// notify does the work of Notify, within its timeout.
+func (r *Receiver) notify(data *alertmanager.Data, logger log.Logger) (bool, error) {
 	project := r.tmpl.Execute(r.conf.Project, data, logger)
 	if err := r.tmpl.Err(); err != nil {
-		return false, err
+		return false, &NotifyError{ErrorValidation, err}
+	}
+	if r.conf.Impersonate != "" {
+		r.impersonate = r.tmpl.Execute(r.conf.Impersonate, data, logger)
+		if err := r.tmpl.Err(); err != nil {
+			return false, &NotifyError{ErrorValidation, err}
+		}
+	}
+	if r.conf.Digest != nil {
+		return r.notifyDigest(project, data, logger)
 	}
 	// Looks like an ALERT metric name, with spaces removed.
-	issueLabel := toIssueLabel(data.GroupLabels)
+	issueLabel, err := r.dedupKey(data, logger)
+	if err != nil {
+		return false, err
+	}
+
+	unlock, ok := r.lockGroup(issueLabel, logger)
+	defer unlock()
+	if !ok {
+		level.Info(logger).Log("msg", "alert group is being handled by another replica, nothing to do", "label", issueLabel)
+		return false, nil
+	}
+	if data.Status != alertmanager.AlertResolved && r.cancelResolve(issueLabel) {
+		level.Info(logger).Log("msg", "alert group fired again within auto_resolve_delay, not resolving its issue", "label", issueLabel)
+	}
 
-	issue, retry, err := r.search(project, issueLabel, logger)
+	var grace time.Duration
+	if r.conf.DedupGrace != nil {
+		grace = time.Duration(*r.conf.DedupGrace)
+	}
+	issue, recentKey, retry, err := r.searchRecent(project, issueLabel, grace, logger)
 	if err != nil {
 		return retry, err
 	}
+	if recentKey != "" {
+		level.Info(logger).Log("msg", "issue recently created but not yet searchable, not creating another", "key", recentKey, "label", issueLabel)
+		r.issueKey = recentKey
+		return false, nil
+	}
+	if issue != nil {
+		r.issueKey = issue.Key
+	}
+
+	if data.Status == alertmanager.AlertResolved {
+		if transition := r.conf.StatusTransitions[alertmanager.AlertResolved]; transition != "" {
+			if issue == nil || issue.Fields.Status.StatusCategory.Key == "done" {
+				level.Debug(logger).Log("msg", "alert group resolved, but there is no unresolved issue to transition", "label", issueLabel)
+				return false, nil
+			}
+			if r.conf.AutoResolveDelay != nil {
+				if wait := resolveDelay(data, time.Duration(*r.conf.AutoResolveDelay), time.Now()); wait > 0 {
+					level.Info(logger).Log("msg", "alert group resolved, resolving its issue unless it fires again", "key", issue.Key, "label", issueLabel, "wait", wait)
+					r.scheduleResolve(project, issueLabel, transition, data, wait, logger)
+					return false, nil
+				}
+			}
+			retry, err := r.statusTransition(issue.Key, alertmanager.AlertResolved, transition, data, logger)
+			if r.issueGone(issue.Key, issueLabel, err, logger) {
+				return false, nil
+			}
+			return retry, err
+		}
+	}
 
 	if issue != nil {
 		// The set of JIRA status categories is fixed, this is a safe check to make.
 		if issue.Fields.Status.StatusCategory.Key != "done" {
-			// Issue is in a "to do" or "in progress" state, all done here.
-			level.Debug(logger).Log("msg", "issue is unresolved, nothing to do", "key", issue.Key, "label", issueLabel)
-			return false, nil
+			// Issue is in a "to do" or "in progress" state, only bring it up to date.
+			retry, err := r.updateUnresolved(issue, issueLabel, data, logger)
+			if !r.issueGone(issue.Key, issueLabel, err, logger) {
+				return retry, err
+			}
+			issue, r.issueKey = nil, ""
 		}
+	}
+	if issue != nil {
 		if r.conf.WontFixResolution != "" && issue.Fields.Resolution != nil &&
 			issue.Fields.Resolution.Name == r.conf.WontFixResolution {
 			// Issue is resolved as "Won't Fix" or equivalent, log a message just in case.
@@ -75,29 +290,293 @@ func (r *Receiver) Notify(data *alertmanager.Data, logger log.Logger) (bool, err
 		}
 
 		resolutionTime := time.Time(issue.Fields.Resolutiondate)
-		if resolutionTime.Add(time.Duration(*r.conf.ReopenDuration)).After(time.Now()) {
+		if r.reopenable(resolutionTime, time.Now()) {
 			level.Info(logger).Log("msg", "issue was recently resolved, reopening", "key", issue.Key, "label", issueLabel, "resolution_time", resolutionTime.Format(time.RFC3339), "reopen_duration", *r.conf.ReopenDuration)
-			return r.reopen(issue.Key, logger)
+			retry, err := r.reopen(issue.Key, logger)
+			if err == nil {
+				issuesReopenedTotal.WithLabelValues(r.conf.Name, projectLabel(project)).Inc()
+				r.audit(auditReopen, data, issue.Key, logger)
+			}
+			if !r.issueGone(issue.Key, issueLabel, err, logger) {
+				return retry, err
+			}
+			r.issueKey = ""
+		}
+	}
+
+	if !r.conf.ActiveAt(time.Now()) {
+		// Deferred rather than dropped: Alertmanager notifies again on its repeat_interval while the alerts fire.
+		level.Info(logger).Log("msg", "outside of active time intervals, not creating issue", "label", issueLabel)
+		outsideActiveTimeTotal.WithLabelValues(r.conf.Name).Inc()
+		return false, nil
+	}
+
+	if r.conf.PreconditionJQL != "" {
+		existing, retry, err := r.checkPrecondition(data, logger)
+		if err != nil || existing != nil {
+			return retry, err
+		}
+	}
+
+	if r.conf.SummaryUnique {
+		existing, retry, err := r.searchSummary(project, data, logger)
+		if err != nil {
+			return retry, err
+		}
+		if existing != nil {
+			r.issueKey = existing.Key
+			return r.adopt(existing, issueLabel, data, logger)
 		}
 	}
 
 	level.Info(logger).Log("msg", "no recent matching issue found, creating new issue", "label", issueLabel)
-	issue = &jira.Issue{
+	issue, fullDescription, err := r.render(data, logger)
+	if err != nil {
+		if r.conf.TemplateErrorFallback && ErrorKindOf(err) == ErrorValidation {
+			return r.createFallback(project, issueLabel, data, err, logger)
+		}
+		return false, err
+	}
+	if retry, err := r.prepareCreate(issue, data, logger); err != nil {
+		return retry, err
+	}
+	retry, err = r.create(issue, logger)
+	if err != nil {
+		return retry, err
+	}
+	level.Info(logger).Log("msg", "issue created", "key", issue.Key, "id", issue.ID)
+	r.issueKey = issue.Key
+	issuesCreatedTotal.WithLabelValues(r.conf.Name, projectLabel(project)).Inc()
+	r.audit(auditCreate, data, issue.Key, logger)
+	recentlyCreated.Add(r.conf.Name+"|"+issueLabel, issue.Key, time.Now())
+
+	// The issue exists at this point. A retry by Alertmanager would find it and do nothing, so failed follow-up steps
+	// are only reported as errors if the receiver asks for it, see postCreateError.
+	var postCreateErr error
+	if r.conf.WaitForIssue != nil {
+		if err := r.waitForIssue(issue.Key, time.Duration(*r.conf.WaitForIssue), logger); err != nil {
+			postCreateErr = r.postCreateError("wait_for_issue", issue.Key, err, logger)
+		}
+	}
+
+	if r.conf.PostCreateTransition != "" {
+		if _, err := r.transition(issue.Key, r.conf.PostCreateTransition, false, logger); err != nil {
+			if err := r.postCreateError("transition", issue.Key, err, logger); postCreateErr == nil {
+				postCreateErr = err
+			}
+		}
+	}
+
+	if r.conf.AttachFullDescription && fullDescription != "" {
+		if _, err := r.attach(issue.Key, fullDescriptionAttachment, fullDescription, logger); err != nil {
+			if err := r.postCreateError("attachment", issue.Key, err, logger); postCreateErr == nil {
+				postCreateErr = err
+			}
+		}
+	}
+
+	if r.conf.AttachCSV {
+		content, err := alertsCSV(data)
+		if err == nil {
+			_, err = r.attach(issue.Key, alertsCSVAttachment, content, logger)
+		}
+		if err != nil {
+			if err := r.postCreateError("attach_csv", issue.Key, err, logger); postCreateErr == nil {
+				postCreateErr = err
+			}
+		}
+	}
+
+	if r.conf.AttachImage != nil {
+		if err := r.attachImage(issue.Key, data, logger); err != nil {
+			if err := r.postCreateError("attach_image", issue.Key, err, logger); postCreateErr == nil {
+				postCreateErr = err
+			}
+		}
+	}
+
+	if r.conf.AddRemoteLinks {
+		if _, err := r.addRemoteLinks(issue.Key, data, logger); err != nil {
+			if err := r.postCreateError("remote_links", issue.Key, err, logger); postCreateErr == nil {
+				postCreateErr = err
+			}
+		}
+	}
+
+	if r.conf.NotifyWebhook != nil {
+		if err := r.notifyWebhook(data, issue.Key, logger); err != nil {
+			if err := r.postCreateError("notify_webhook", issue.Key, err, logger); postCreateErr == nil {
+				postCreateErr = err
+			}
+		}
+	}
+	return false, postCreateErr
+}
+
+// lockGroup serializes the search-then-create sequence of an alert group (or digest) key, so concurrent deliveries
+// can't both create an issue: within this process, and across replicas with ReplicaLock. ok is false if another
+// replica is already handling the key, which is then best left to that one. unlock must be called either way.
+func (r *Receiver) lockGroup(issueLabel string, logger log.Logger) (unlock func(), ok bool) {
+	key := r.conf.Name + "|" + issueLabel
+	unlockGroup := groupLocks.Lock(key)
+	release, ok, err := ReplicaLock.TryLock(key)
+	switch {
+	case err != nil:
+		level.Warn(logger).Log("msg", "failed to acquire replica lock, proceeding without", "label", issueLabel, "err", err)
+		return unlockGroup, true
+	case !ok:
+		return unlockGroup, false
+	}
+	return func() {
+		release()
+		unlockGroup()
+	}, true
+}
+
+// searchRecent searches the issue of an alert group (or digest) key. If there is none but one was created for it
+// less than grace ago, the search is retried to give JIRA's index a chance to catch up; if that doesn't find it
+// either, its key is returned as recentKey, so no other issue is created.
+func (r *Receiver) searchRecent(project, issueLabel string, grace time.Duration, logger log.Logger) (issue *jira.Issue, recentKey string, retry bool, err error) {
+	issue, retry, err = r.search(project, issueLabel, logger)
+	if err != nil || issue != nil || grace <= 0 {
+		return issue, "", retry, err
+	}
+	recent, ok := recentlyCreated.Get(r.conf.Name+"|"+issueLabel, time.Now())
+	if !ok || time.Since(recent.created) >= grace {
+		return nil, "", false, nil
+	}
+	// We created an issue for this group moments ago, give the search index a chance to catch up.
+	for i := 0; i < dedupSearchRetries && issue == nil; i++ {
+		time.Sleep(dedupSearchRetryDelay)
+		if issue, retry, err = r.search(project, issueLabel, logger); err != nil {
+			return nil, "", retry, err
+		}
+	}
+	if issue == nil {
+		return nil, recent.issueKey, false, nil
+	}
+	return issue, "", false, nil
+}
+
+// prepareCreate completes a rendered issue before it is created: checks its request and issue types, sets the
+// assignee, resolves component names to IDs and applies the transform hook, as configured.
+func (r *Receiver) prepareCreate(issue *jira.Issue, data *alertmanager.Data, logger log.Logger) (bool, error) {
+	if r.conf.RequestTypeField != "" {
+		if retry, err := r.checkRequestType(issue, logger); err != nil {
+			return retry, err
+		}
+	}
+	if retry, err := r.checkIssueType(issue, logger); err != nil {
+		return retry, err
+	}
+	if r.conf.Assignee != "" || r.conf.OnCall != nil {
+		if err := r.assign(issue, data, logger); err != nil {
+			return false, err
+		}
+	}
+	if r.conf.ResolveIDs && (len(issue.Fields.Components) > 0 || issue.Fields.Unknowns["fixVersions"] != nil) {
+		if retry, err := r.resolveIDs(issue, logger); err != nil {
+			return retry, err
+		}
+	}
+	if r.conf.Transform != nil {
+		if err := r.transform(issue, logger); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// postCreateError records a failed step after creating an issue, which needs manual follow-up. It returns an error
+// only if the receiver is configured to fail the notification in that case.
+func (r *Receiver) postCreateError(step, issueKey string, err error, logger log.Logger) error {
+	postCreateErrorsTotal.WithLabelValues(r.conf.Name, step).Inc()
+	level.Warn(logger).Log("msg", "issue created, but a follow-up step failed and needs to be done manually", "key", issueKey, "step", step, "err", err)
+	if !r.conf.FailOnPostCreateError {
+		return nil
+	}
+	return fmt.Errorf("issue %s created, but %s failed: %s", issueKey, step, err)
+}
+
+// Render returns the issue Notify would create for the given data, without contacting JIRA.
+func (r *Receiver) Render(data *alertmanager.Data, logger log.Logger) (*jira.Issue, error) {
+	issue, _, err := r.render(data, logger)
+	return issue, err
+}
+
+// render builds a new issue from the receiver's templates. If the description had to be shortened, the full
+// description is returned alongside the issue.
+func (r *Receiver) render(data *alertmanager.Data, logger log.Logger) (*jira.Issue, string, error) {
+	project := r.tmpl.Execute(r.conf.Project, data, logger)
+	issueLabel, err := r.dedupKey(data, logger)
+	if err != nil {
+		return nil, "", err
+	}
+
+	descriptionData := data
+	if max := r.conf.MaxAlertsInDescription; max > 0 && len(data.Alerts) > max {
+		truncated := *data
+		truncated.Alerts = data.Alerts[:max]
+		truncated.TruncatedAlerts += len(data.Alerts) - max
+		descriptionData = &truncated
+	}
+	description, ok := r.annotationContent(r.conf.Description, defaultDescriptionTemplate, "description", data)
+	if !ok {
+		description = r.tmpl.Execute(r.conf.Description, descriptionData, logger)
+	}
+	if r.conf.DescriptionFormat == config.DescriptionFormatMarkdown {
+		description = markdownToWiki(description)
+	}
+	fullDescription := ""
+	if r.conf.MaxDescriptionChars > 0 && utf8.RuneCountInString(description) > r.conf.MaxDescriptionChars {
+		note := "\n\n[...] Description truncated."
+		if r.conf.AttachFullDescription {
+			note += " See attachment " + fullDescriptionAttachment + " for the full text."
+		}
+		fullDescription = description
+		description = truncateRunes(description, r.conf.MaxDescriptionChars, note)
+		level.Warn(logger).Log("msg", "description too long, truncating", "label", issueLabel, "length", utf8.RuneCountInString(fullDescription), "max_description_chars", r.conf.MaxDescriptionChars)
+	}
+	issue := &jira.Issue{
 		Fields: &jira.IssueFields{
 			Project:     jira.Project{Key: project},
-			Type:        jira.IssueType{Name: r.tmpl.Execute(r.conf.IssueType, data, logger)},
-			Description: r.tmpl.Execute(r.conf.Description, data, logger),
-			Summary:     r.tmpl.Execute(r.conf.Summary, data, logger),
-			Labels: []string{
-				issueLabel,
-			},
+			Type:        r.renderIssueType(data, logger),
+			Description: description,
+			Summary:     r.renderSummary(data, logger),
+			Labels:   []string{},
 			Unknowns: tcontainer.NewMarshalMap(),
 		},
 	}
+	if r.conf.DedupField != "" {
+		issue.Fields.Unknowns[r.conf.DedupField] = issueLabel
+	} else {
+		issue.Fields.Labels = append(issue.Fields.Labels, issueLabel)
+	}
+	if r.conf.APIVersion == "3" && description != "" {
+		// API v3 only accepts descriptions in Atlassian Document Format.
+		issue.Fields.Description = ""
+		issue.Fields.Unknowns["description"] = toADF(description)
+	}
 	if r.conf.Priority != "" {
 		issue.Fields.Priority = &jira.Priority{Name: r.tmpl.Execute(r.conf.Priority, data, logger)}
 	}
 
+	// Add time tracking estimates
+	if r.conf.OriginalEstimate != "" || r.conf.RemainingEstimate != "" {
+		tt := &jira.TimeTracking{
+			OriginalEstimate:  strings.TrimSpace(r.tmpl.Execute(r.conf.OriginalEstimate, data, logger)),
+			RemainingEstimate: strings.TrimSpace(r.tmpl.Execute(r.conf.RemainingEstimate, data, logger)),
+		}
+		for _, estimate := range []string{tt.OriginalEstimate, tt.RemainingEstimate} {
+			if estimate != "" && !estimateRE.MatchString(estimate) {
+				return nil, "", fmt.Errorf("invalid time tracking estimate %q, expected e.g. \"2h 30m\"", estimate)
+			}
+		}
+		if tt.OriginalEstimate != "" || tt.RemainingEstimate != "" {
+			issue.Fields.TimeTracking = tt
+		}
+	}
+
 	// Add Components
 	if len(r.conf.Components) > 0 {
 		issue.Fields.Components = make([]*jira.Component, 0, len(r.conf.Components))
@@ -107,24 +586,486 @@ func (r *Receiver) Notify(data *alertmanager.Data, logger log.Logger) (bool, err
 	}
 
 	// Add Labels
-	if r.conf.AddGroupLabels {
-		for k, v := range data.GroupLabels {
-			issue.Fields.Labels = append(issue.Fields.Labels, fmt.Sprintf("%s=%q", k, v))
+	issue.Fields.Labels = append(issue.Fields.Labels, r.renderLabels(data, logger)...)
+	if r.conf.MaxLabels > 0 && len(issue.Fields.Labels) > r.conf.MaxLabels {
+		var dropped []string
+		issue.Fields.Labels, dropped = limitLabelCount(issue.Fields.Labels, r.conf.MaxLabels, append([]string{issueLabel, r.receiverLabel()}, r.staticLabels()...))
+		level.Warn(logger).Log("msg", "too many labels, dropping some", "label", issueLabel, "dropped", strings.Join(dropped, " "), "max_labels", r.conf.MaxLabels)
+	}
+
+	fields, err := r.renderFields(data, logger)
+	if err != nil {
+		return nil, "", err
+	}
+	for key, value := range fields {
+		issue.Fields.Unknowns[key] = value
+	}
+	if r.conf.RequestTypeField != "" {
+		if requestType := strings.TrimSpace(r.tmpl.Execute(r.conf.RequestType, data, logger)); requestType != "" {
+			issue.Fields.Unknowns[r.conf.RequestTypeField] = requestType
+		}
+	}
+	if epic := strings.TrimSpace(r.tmpl.Execute(r.conf.EpicLink, data, logger)); epic != "" {
+		// JIRA rejects the issue if the epic doesn't exist, which surfaces as the create error.
+		if r.conf.EpicLinkField == "parent" {
+			issue.Fields.Unknowns["parent"] = map[string]interface{}{"key": epic}
+		} else {
+			issue.Fields.Unknowns[r.conf.EpicLinkField] = epic
 		}
 	}
+	if r.conf.ExternalURLField != "" && data.ExternalURL != "" {
+		issue.Fields.Unknowns[r.conf.ExternalURLField] = data.ExternalURL
+	}
+	if r.conf.GroupKeyField != "" && data.GroupKey != "" {
+		issue.Fields.Unknowns[r.conf.GroupKeyField] = data.GroupKey
+	}
+	if fps := data.Alerts.Fingerprints(); r.conf.FingerprintsField != "" && len(fps) > 0 {
+		issue.Fields.Unknowns[r.conf.FingerprintsField] = strings.Join(fps, ",")
+	}
+	if runbook := strings.TrimSpace(data.CommonAnnotations["runbook_url"]); r.conf.RunbookField != "" && runbook != "" {
+		issue.Fields.Unknowns[r.conf.RunbookField] = runbook
+	}
+	if r.conf.AlertCountField != "" {
+		issue.Fields.Unknowns[r.conf.AlertCountField] = len(data.Alerts.Firing())
+	}
 
+	if err := r.tmpl.Err(); err != nil {
+		return nil, "", &NotifyError{ErrorValidation, err}
+	}
+	return issue, fullDescription, nil
+}
+
+// renderFields renders the receiver's fields, leaving out those rendering empty unless listed in keep_empty_fields.
+func (r *Receiver) renderFields(data *alertmanager.Data, logger log.Logger) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, len(r.conf.Fields))
 	for key, value := range r.conf.Fields {
-		issue.Fields.Unknowns[key] = deepCopyWithTemplate(value, r.tmpl, data, logger)
+		rendered := deepCopyWithTemplate(value, r.tmpl, data, logger)
+		if isEmptyValue(rendered) && !r.conf.KeepEmptyField(key) {
+			level.Debug(logger).Log("msg", "field rendered empty, omitting", "field", key)
+			continue
+		}
+		if r.conf.NumericField(key) {
+			var err error
+			if rendered, err = toNumber(rendered); err != nil {
+				return nil, &NotifyError{ErrorValidation, fmt.Errorf("numeric field %s: %s", key, err)}
+			}
+		}
+		fields[key] = rendered
+	}
+	return fields, nil
+}
+
+// renderLabels returns the labels to add to the issue for the alert group, besides the dedup label.
+func (r *Receiver) renderLabels(data *alertmanager.Data, logger log.Logger) []string {
+	var labels []string
+	allowed := make(map[string]bool, len(r.conf.LabelAllowlist))
+	for _, name := range r.conf.LabelAllowlist {
+		allowed[name] = true
+	}
+	if r.conf.AddGroupLabels {
+		for k, v := range data.GroupLabels {
+			if len(allowed) == 0 || allowed[k] {
+				labels = append(labels, fmt.Sprintf("%s=%q", k, v))
+			}
+		}
+	}
+	for _, name := range r.conf.LabelAllowlist {
+		if v, ok := data.CommonLabels[name]; ok && v != "" {
+			if r.conf.LabelFormat == config.LabelFormatValue {
+				labels = append(labels, sanitizeLabel(v))
+			} else {
+				labels = append(labels, sanitizeLabel(name+"_"+v))
+			}
+		}
 	}
+	if r.conf.TagReceiver {
+		labels = append(labels, r.receiverLabel())
+	}
+	if r.conf.FingerprintLabels {
+		for _, fp := range data.Alerts.Fingerprints() {
+			labels = append(labels, "fingerprint_"+fp)
+		}
+	}
+	seen := make(map[string]bool, len(labels))
+	for _, l := range labels {
+		seen[l] = true
+	}
+	for _, text := range r.conf.Labels {
+		for _, l := range r.splitLabels(r.tmpl.Execute(text, data, logger)) {
+			if l = sanitizeLabel(l); l != "" && !seen[l] {
+				seen[l] = true
+				labels = append(labels, l)
+			}
+		}
+	}
+	var overlong []string
+	labels, overlong = limitLabelLength(labels, r.conf.LabelOverflow == config.LabelOverflowDrop)
+	if len(overlong) > 0 {
+		level.Warn(logger).Log("msg", "labels exceed maximum length", "action", r.conf.LabelOverflow, "labels", strings.Join(overlong, " "), "max_length", maxLabelLength)
+	}
+	return labels
+}
 
+// updateLabels brings the labels of an existing issue in line with the alert group, adding missing ones and removing
+// those JIRAlert added for alerts no longer in the group. Labels added by hand and the dedup label are kept.
+func (r *Receiver) updateLabels(issue *jira.Issue, issueLabel string, data *alertmanager.Data, logger log.Logger) (bool, error) {
+	desired := r.renderLabels(data, logger)
 	if err := r.tmpl.Err(); err != nil {
 		return false, err
 	}
-	retry, err = r.create(issue, logger)
-	if err == nil {
-		level.Info(logger).Log("msg", "issue created", "key", issue.Key, "id", issue.ID)
+	if r.conf.DedupField == "" {
+		// Counted towards max_labels, as when creating the issue.
+		desired = append([]string{issueLabel}, desired...)
 	}
-	return retry, err
+	if r.conf.MaxLabels > 0 && len(desired) > r.conf.MaxLabels {
+		var dropped []string
+		desired, dropped = limitLabelCount(desired, r.conf.MaxLabels, append([]string{issueLabel, r.receiverLabel()}, r.staticLabels()...))
+		level.Warn(logger).Log("msg", "too many labels, dropping some", "key", issue.Key, "dropped", strings.Join(dropped, " "), "max_labels", r.conf.MaxLabels)
+	}
+	add, remove := labelDiff(issue.Fields.Labels, desired, r.managedLabel, issueLabel)
+	if len(add) == 0 && len(remove) == 0 {
+		level.Debug(logger).Log("msg", "issue is unresolved and its labels are up to date, nothing to do", "key", issue.Key, "label", issueLabel)
+		return false, nil
+	}
+
+	ops := make([]map[string]string, 0, len(add)+len(remove))
+	for _, l := range add {
+		ops = append(ops, map[string]string{"add": l})
+	}
+	for _, l := range remove {
+		ops = append(ops, map[string]string{"remove": l})
+	}
+	level.Info(logger).Log("msg", "updating labels of unresolved issue", "key", issue.Key, "add", strings.Join(add, " "), "remove", strings.Join(remove, " "))
+	resp, err := r.client.Issue.UpdateIssue(issue.Key, map[string]interface{}{"update": map[string]interface{}{"labels": ops}})
+	if err != nil {
+		return r.handleJiraError("Issue.UpdateIssue", resp, err, logger)
+	}
+	r.audit(auditUpdate, data, issue.Key, logger)
+	return false, nil
+}
+
+// receiverLabel returns the "<key>:<receiver>" label of the JIRAlert receiver creating the issue, if it is configured
+// with tag_receiver.
+func (r *Receiver) receiverLabel() string {
+	if !r.conf.TagReceiver {
+		return ""
+	}
+	return sanitizeLabel(r.conf.ReceiverLabelKey + ":" + r.conf.Name)
+}
+
+// updateAlertCount sets the alert count field of an existing issue to the number of firing alerts, if it differs.
+func (r *Receiver) updateAlertCount(issue *jira.Issue, data *alertmanager.Data, logger log.Logger) (bool, error) {
+	count := len(data.Alerts.Firing())
+	// Numbers are decoded as float64.
+	if current, ok := issue.Fields.Unknowns[r.conf.AlertCountField].(float64); ok && int(current) == count {
+		return false, nil
+	}
+	level.Debug(logger).Log("msg", "updating alert count", "key", issue.Key, "field", r.conf.AlertCountField, "count", count)
+	resp, err := r.client.Issue.UpdateIssue(issue.Key, map[string]interface{}{"fields": map[string]interface{}{r.conf.AlertCountField: count}})
+	if err != nil {
+		return r.handleJiraError("Issue.UpdateIssue", resp, err, logger)
+	}
+	r.audit(auditUpdate, data, issue.Key, logger)
+	return false, nil
+}
+
+// splitLabels splits a labels entry on LabelSeparator and, with LabelsMultiline, on newlines.
+func (r *Receiver) splitLabels(text string) []string {
+	sep := r.conf.LabelSeparator
+	if sep == "" {
+		sep = ","
+	}
+	if !r.conf.LabelsMultiline {
+		return strings.Split(text, sep)
+	}
+	var parts []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		parts = append(parts, strings.Split(line, sep)...)
+	}
+	return parts
+}
+
+// staticLabels returns the labels from the receiver's labels that aren't templates.
+func (r *Receiver) staticLabels() []string {
+	var labels []string
+	for _, text := range r.conf.Labels {
+		if strings.Contains(text, r.conf.LeftDelim()) {
+			continue
+		}
+		for _, l := range r.splitLabels(text) {
+			if l = sanitizeLabel(l); l != "" {
+				labels = append(labels, l)
+			}
+		}
+	}
+	return labels
+}
+
+// limitLabelCount returns at most max of the given labels, those also in keep first, followed by the others in order.
+// It also returns the labels dropped.
+func limitLabelCount(labels []string, max int, keep []string) ([]string, []string) {
+	if len(labels) <= max {
+		return labels, nil
+	}
+	keepSet := make(map[string]bool, len(keep))
+	for _, l := range keep {
+		keepSet[l] = true
+	}
+	ordered := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if keepSet[l] {
+			ordered = append(ordered, l)
+		}
+	}
+	for _, l := range labels {
+		if !keepSet[l] {
+			ordered = append(ordered, l)
+		}
+	}
+	return ordered[:max], ordered[max:]
+}
+
+// managedLabel reports whether label looks like one renderLabels produces from alert labels, so that it may be removed
+// once no longer rendered. Labels from templates or in LabelFormatValue format can't be told apart from labels added by
+// hand and are never removed.
+func (r *Receiver) managedLabel(label string) bool {
+	if r.conf.AddGroupLabels && groupLabelRE.MatchString(label) {
+		return true
+	}
+	if r.conf.FingerprintLabels && strings.HasPrefix(label, "fingerprint_") {
+		return true
+	}
+	if r.conf.TagReceiver && strings.HasPrefix(label, sanitizeLabel(r.conf.ReceiverLabelKey)+":") {
+		return true
+	}
+	if r.conf.LabelFormat == config.LabelFormatValue {
+		return false
+	}
+	for _, name := range r.conf.LabelAllowlist {
+		if strings.HasPrefix(label, sanitizeLabel(name)+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// groupLabelRE matches labels added for group labels by add_group_labels.
+var groupLabelRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*=".*"$`)
+
+// labelDiff returns the desired labels missing from current and the managed labels in current that aren't desired.
+// The reserved label is never removed.
+func labelDiff(current, desired []string, managed func(string) bool, reserved string) (add, remove []string) {
+	have := make(map[string]bool, len(current))
+	for _, l := range current {
+		have[l] = true
+	}
+	want := make(map[string]bool, len(desired))
+	for _, l := range desired {
+		if !want[l] && !have[l] {
+			add = append(add, l)
+		}
+		want[l] = true
+	}
+	for _, l := range current {
+		if l != reserved && !want[l] && managed(l) {
+			remove = append(remove, l)
+		}
+	}
+	return add, remove
+}
+
+// renderSummary renders the receiver's summary prefix and summary, plus the alert count suffix if there are more alerts
+// than the summary_count_threshold, shortening the summary so the result fits JIRA's summary length limit.
+func (r *Receiver) renderSummary(data *alertmanager.Data, logger log.Logger) string {
+	base, suffix := r.renderSummaryParts(data, logger)
+	return base + suffix
+}
+
+// renderSummaryParts returns the summary prefix and summary, shortened as in renderSummary, and the alert count
+// suffix separately, as the count changes over the life of an issue but its summary doesn't.
+func (r *Receiver) renderSummaryParts(data *alertmanager.Data, logger log.Logger) (base, suffix string) {
+	prefix := r.tmpl.Execute(r.conf.SummaryPrefix, data, logger)
+	summary, ok := r.annotationContent(r.conf.Summary, defaultSummaryTemplate, "summary", data)
+	if !ok {
+		summary = r.tmpl.Execute(r.conf.Summary, data, logger)
+	}
+	if t := r.conf.SummaryCountThreshold; t > 0 && len(data.Alerts) > t {
+		suffix = fmt.Sprintf(" (%d alerts)", len(data.Alerts))
+	}
+
+	max := maxSummaryLength - utf8.RuneCountInString(prefix) - utf8.RuneCountInString(suffix)
+	if max < 0 {
+		max = 0
+	}
+	if utf8.RuneCountInString(summary) > max {
+		level.Warn(logger).Log("msg", "summary too long, truncating", "summary", summary, "max_length", maxSummaryLength)
+		summary = truncateRunes(summary, max, "")
+	}
+	return prefix + summary, suffix
+}
+
+// summaryCountRE matches the alert count suffix of summaries, see renderSummaryParts.
+var summaryCountRE = regexp.MustCompile(` \(\d+ alerts\)$`)
+
+// sameSummary reports whether an existing issue's summary is the one rendered as base, whatever alert count suffix
+// either was rendered with. The existing summary may be shorter, if it was shortened to fit a longer suffix.
+func (r *Receiver) sameSummary(existing, base string) bool {
+	full := utf8.RuneCountInString(existing) == maxSummaryLength
+	if r.conf.SummaryCountThreshold > 0 {
+		existing = summaryCountRE.ReplaceAllString(existing, "")
+		base = summaryCountRE.ReplaceAllString(base, "")
+	}
+	return existing == base || (full && existing != "" && strings.HasPrefix(base, existing))
+}
+
+// annotationContent returns the value of the annotation named AnnotationPrefix+name, if common to the alert group
+// and tmpl is the default template def. Receivers with a template of their own ignore the annotation.
+func (r *Receiver) annotationContent(tmpl, def, name string, data *alertmanager.Data) (string, bool) {
+	if strings.TrimSpace(tmpl) != def {
+		return "", false
+	}
+	v := data.CommonAnnotations[r.conf.AnnotationPrefix+name]
+	return v, v != ""
+}
+
+// truncateRunes shortens s on a rune boundary so that, with note appended, it is at most max runes long.
+func truncateRunes(s string, max int, note string) string {
+	keep := max - utf8.RuneCountInString(note)
+	if keep <= 0 {
+		note, keep = "", max
+	}
+	n := 0
+	for i := range s {
+		if n == keep {
+			return s[:i] + note
+		}
+		n++
+	}
+	return s
+}
+
+// checkRequestType verifies that issues in JIRA Service Management projects have a customer request type.
+func (r *Receiver) checkRequestType(issue *jira.Issue, logger log.Logger) (bool, error) {
+	if _, ok := issue.Fields.Unknowns[r.conf.RequestTypeField]; ok {
+		return false, nil
+	}
+	project, retry, err := r.project(issue.Fields.Project.Key, logger)
+	if err != nil {
+		return retry, err
+	}
+	if project.ProjectTypeKey == projectTypeServiceDesk {
+		return false, fmt.Errorf("project %s is a service desk project, but request_type is empty", project.Key)
+	}
+	return false, nil
+}
+
+// renderIssueType returns the issue type by ID if the receiver has issue_type_id, by name otherwise.
+func (r *Receiver) renderIssueType(data *alertmanager.Data, logger log.Logger) jira.IssueType {
+	if r.conf.IssueTypeID != "" {
+		return jira.IssueType{ID: r.tmpl.Execute(r.conf.IssueTypeID, data, logger)}
+	}
+	return jira.IssueType{Name: r.tmpl.Execute(r.conf.IssueType, data, logger)}
+}
+
+// checkIssueType verifies that the issue type exists in the project and, if given by name, is not ambiguous. If the
+// project can't be fetched for the time being, or at all with the receiver's permissions, the issue is created
+// unchecked rather than delayed or dropped.
+func (r *Receiver) checkIssueType(issue *jira.Issue, logger log.Logger) (bool, error) {
+	project, retry, err := r.project(issue.Fields.Project.Key, logger)
+	if err != nil {
+		if kind := ErrorKindOf(err); kind == ErrorTransient || kind == ErrorAuth || isNotFound(err) {
+			level.Warn(logger).Log("msg", "failed to fetch project, not checking issue type", "project", issue.Fields.Project.Key, "err", err)
+			return false, nil
+		}
+		return retry, err
+	}
+	if len(project.IssueTypes) == 0 {
+		// Not returned, e.g. for lack of permissions, leave it to JIRA.
+		return false, nil
+	}
+	want := issue.Fields.Type
+	var matches, available []string
+	for _, t := range project.IssueTypes {
+		if (want.ID != "" && t.ID == want.ID) || (want.ID == "" && t.Name == want.Name) {
+			matches = append(matches, t.ID)
+		}
+		available = append(available, fmt.Sprintf("%q (ID %s)", t.Name, t.ID))
+	}
+	switch {
+	case len(matches) == 0 && want.ID != "":
+		return false, &NotifyError{ErrorValidation, fmt.Errorf("issue type ID %s does not exist in project %s, available issue types: %s", want.ID, project.Key, strings.Join(available, ", "))}
+	case len(matches) == 0:
+		return false, &NotifyError{ErrorValidation, fmt.Errorf("issue type %q does not exist in project %s, available issue types: %s", want.Name, project.Key, strings.Join(available, ", "))}
+	case len(matches) > 1:
+		return false, &NotifyError{ErrorValidation, fmt.Errorf("issue type %q is ambiguous in project %s (IDs %s), set issue_type_id instead", want.Name, project.Key, strings.Join(matches, ", "))}
+	}
+	return false, nil
+}
+
+// resolveIDs replaces the names of the issue's components, and of the fix versions set from fields, with the matching
+// IDs of the project. Those already identified by ID are left alone.
+func (r *Receiver) resolveIDs(issue *jira.Issue, logger log.Logger) (bool, error) {
+	projectKey := issue.Fields.Project.Key
+	project, retry, err := r.project(projectKey, logger)
+	if err != nil {
+		return retry, err
+	}
+	ids := make(map[string]string, len(project.Components))
+	for _, pc := range project.Components {
+		ids[pc.Name] = pc.ID
+	}
+	for _, c := range issue.Fields.Components {
+		if c.ID != "" {
+			continue
+		}
+		id, ok := ids[c.Name]
+		if !ok {
+			return false, fmt.Errorf("component %q does not exist in project %s", c.Name, projectKey)
+		}
+		c.ID, c.Name = id, ""
+	}
+
+	versions, _ := issue.Fields.Unknowns["fixVersions"].([]interface{})
+	ids = make(map[string]string, len(project.Versions))
+	for _, pv := range project.Versions {
+		ids[pv.Name] = pv.ID
+	}
+	for i, v := range versions {
+		// Fix versions are given as e.g. {name: "1.2"}.
+		m, ok := v.(map[string]interface{})
+		if !ok || m["id"] != nil {
+			continue
+		}
+		name, _ := m["name"].(string)
+		id, ok := ids[name]
+		if !ok {
+			return false, fmt.Errorf("version %q does not exist in project %s", name, projectKey)
+		}
+		versions[i] = map[string]interface{}{"id": id}
+	}
+	return false, nil
+}
+
+// toADF converts plain text into an Atlassian Document Format document, with one paragraph per blank line separated
+// block and hard breaks between the lines of a block.
+func toADF(text string) map[string]interface{} {
+	paragraphs := []interface{}{}
+	for _, block := range strings.Split(text, "\n\n") {
+		content := []interface{}{}
+		for _, line := range strings.Split(block, "\n") {
+			if line == "" {
+				continue
+			}
+			if len(content) > 0 {
+				content = append(content, map[string]interface{}{"type": "hardBreak"})
+			}
+			content = append(content, map[string]interface{}{"type": "text", "text": line})
+		}
+		if len(content) > 0 {
+			paragraphs = append(paragraphs, map[string]interface{}{"type": "paragraph", "content": content})
+		}
+	}
+	return map[string]interface{}{"version": 1, "type": "doc", "content": paragraphs}
 }
 
 // deepCopyWithTemplate returns a deep copy of a map/slice/array/string/int/bool or combination thereof, executing the
@@ -168,30 +1109,180 @@ func deepCopyWithTemplate(value interface{}, tmpl *template.Template, data inter
 	}
 }
 
-// toIssueLabel returns the group labels in the form of an ALERT metric name, with all spaces removed.
-func toIssueLabel(groupLabels alertmanager.KV) string {
-	buf := bytes.NewBufferString("ALERT{")
+// toNumber converts a rendered field value to a JSON number, kept as text so large integers don't lose precision. An
+// empty value becomes null, clearing the field.
+func toNumber(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		// Already a number (or something else) in the configuration, submitted as is.
+		return value, nil
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if !jsonNumberRE.MatchString(s) {
+		return nil, fmt.Errorf("rendered value %q is not a number", s)
+	}
+	return json.Number(s), nil
+}
+
+// isEmptyValue reports whether a rendered field value carries no information: a string that is empty after trimming
+// whitespace, or a map or slice containing only such values.
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []interface{}:
+		for _, e := range v {
+			if !isEmptyValue(e) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		for _, e := range v {
+			if !isEmptyValue(e) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// dedupKey returns the key identifying the issue for the alert group: its group labels or, with DedupKeyTemplate,
+// the hash of the identity the template renders.
+func (r *Receiver) dedupKey(data *alertmanager.Data, logger log.Logger) (string, error) {
+	prefix := r.conf.DedupLabelPrefix
+	if prefix == "" {
+		prefix = "ALERT"
+	}
+	if r.conf.DedupKeyTemplate == "" {
+		groupLabels := r.stableGroupLabels(data.GroupLabels)
+		if len(groupLabels) == 0 && len(data.GroupLabels) > 0 {
+			// All alert groups would share one issue.
+			return "", &NotifyError{ErrorValidation, fmt.Errorf("no stable group labels in group %s, see dedup_labels and dedup_ignore_labels", data.GroupLabels.Values())}
+		}
+		return toIssueLabel(prefix, groupLabels), nil
+	}
+	identity := r.tmpl.Execute(r.conf.DedupKeyTemplate, data, logger)
+	if err := r.tmpl.Err(); err != nil {
+		return "", &NotifyError{ErrorValidation, err}
+	}
+	if strings.TrimSpace(identity) == "" {
+		// All alert groups would share one issue.
+		return "", &NotifyError{ErrorValidation, fmt.Errorf("dedup_key_template rendered empty for group %s", data.GroupLabels.Values())}
+	}
+	sum := sha256.Sum256([]byte(identity))
+	return prefix + "{" + hex.EncodeToString(sum[:8]) + "}", nil
+}
+
+// stableGroupLabels returns the group labels forming the dedup key: those in DedupLabels if set, all but those in
+// DedupIgnoreLabels otherwise.
+func (r *Receiver) stableGroupLabels(groupLabels alertmanager.KV) alertmanager.KV {
+	if len(r.conf.DedupLabels) == 0 && len(r.conf.DedupIgnoreLabels) == 0 {
+		return groupLabels
+	}
+	stable := alertmanager.KV{}
+	for _, name := range r.conf.DedupLabels {
+		if v, ok := groupLabels[name]; ok {
+			stable[name] = v
+		}
+	}
+	if len(r.conf.DedupIgnoreLabels) > 0 {
+		ignore := make(map[string]bool, len(r.conf.DedupIgnoreLabels))
+		for _, name := range r.conf.DedupIgnoreLabels {
+			ignore[name] = true
+		}
+		for name, v := range groupLabels {
+			if !ignore[name] {
+				stable[name] = v
+			}
+		}
+	}
+	return stable
+}
+
+// toIssueLabel returns the group labels in the form of a metric name (e.g. ALERT), with all spaces removed.
+func toIssueLabel(prefix string, groupLabels alertmanager.KV) string {
+	buf := bytes.NewBufferString(prefix + "{")
 	for _, p := range groupLabels.SortedPairs() {
 		buf.WriteString(p.Name)
 		buf.WriteString(fmt.Sprintf("=%q,", p.Value))
 	}
 	buf.Truncate(buf.Len() - 1)
 	buf.WriteString("}")
-	return strings.Replace(buf.String(), " ", "", -1)
+	// Truncated like any other label, see limitLabelLength, but the same way when storing and searching.
+	return truncateRunes(strings.Replace(buf.String(), " ", "", -1), maxLabelLength, "")
+}
+
+// sanitizeLabel replaces the whitespace JIRA doesn't allow in labels with underscores.
+func sanitizeLabel(label string) string {
+	return strings.Join(strings.Fields(label), "_")
+}
+
+// limitLabelLength truncates labels longer than maxLabelLength or, if drop is set, leaves them out. It returns the
+// resulting labels and the original labels affected.
+func limitLabelLength(labels []string, drop bool) ([]string, []string) {
+	var (
+		res      = make([]string, 0, len(labels))
+		affected []string
+	)
+	for _, l := range labels {
+		if utf8.RuneCountInString(l) <= maxLabelLength {
+			res = append(res, l)
+			continue
+		}
+		affected = append(affected, l)
+		if !drop {
+			res = append(res, truncateRunes(l, maxLabelLength, ""))
+		}
+	}
+	return res, affected
 }
 
 func (r *Receiver) search(project, issueLabel string, logger log.Logger) (*jira.Issue, bool, error) {
 	query := fmt.Sprintf("project=\"%s\" and labels=%q order by resolutiondate desc", project, issueLabel)
 	options := &jira.SearchOptions{
-		Fields:     []string{"summary", "status", "resolution", "resolutiondate"},
+		Fields:     []string{"summary", "status", "resolution", "resolutiondate", "labels"},
 		MaxResults: 2,
 	}
+	if r.conf.DedupField != "" {
+		// Text fields only support (tokenized) phrase searches, so search for the words of the key and keep the issues
+		// whose field matches exactly.
+		query = fmt.Sprintf("project=\"%s\" and cf[%s] ~ %q order by resolutiondate desc", project,
+			strings.TrimPrefix(r.conf.DedupField, "customfield_"), fmt.Sprintf("%q", strings.Join(dedupWordsRE.FindAllString(issueLabel, -1), " ")))
+		options.Fields = append(options.Fields, r.conf.DedupField)
+		options.MaxResults = 10
+	}
+	if r.conf.AlertCountField != "" {
+		options.Fields = append(options.Fields, r.conf.AlertCountField)
+	}
+	if len(r.conf.EscalatePriority) > 0 {
+		options.Fields = append(options.Fields, "priority")
+	}
+	if r.conf.StripResolvedOnUpdate {
+		for key := range r.conf.Fields {
+			options.Fields = append(options.Fields, key)
+		}
+	}
 	level.Debug(logger).Log("msg", "search", "query", query, "options", options)
 	issues, resp, err := r.client.Issue.Search(query, options)
 	if err != nil {
-		retry, err := handleJiraError("Issue.Search", resp, err, logger)
+		retry, err := r.handleJiraError("Issue.Search", resp, err, logger)
 		return nil, retry, err
 	}
+	if r.conf.DedupField != "" {
+		exact := issues[:0]
+		for _, issue := range issues {
+			if v, ok := issue.Fields.Unknowns[r.conf.DedupField].(string); ok && v == issueLabel {
+				exact = append(exact, issue)
+			}
+		}
+		issues = exact
+	}
 	if len(issues) > 0 {
 		if len(issues) > 1 {
 			// Swallow it, but log a message.
@@ -205,31 +1296,218 @@ func (r *Receiver) search(project, issueLabel string, logger log.Logger) (*jira.
 	return nil, false, nil
 }
 
+// checkPrecondition runs the receiver's precondition JQL and returns the first matching issue, if any, commenting on it
+// when a precondition comment is configured.
+func (r *Receiver) checkPrecondition(data *alertmanager.Data, logger log.Logger) (*jira.Issue, bool, error) {
+	query := strings.TrimSpace(r.tmpl.Execute(r.conf.PreconditionJQL, data, logger))
+	if err := r.tmpl.Err(); err != nil {
+		return nil, false, err
+	}
+	if query == "" {
+		return nil, false, fmt.Errorf("precondition_jql rendered empty")
+	}
+
+	level.Debug(logger).Log("msg", "precondition search", "query", query)
+	issues, resp, err := r.client.Issue.Search(query, &jira.SearchOptions{Fields: []string{"summary"}, MaxResults: 1})
+	if err != nil {
+		retry, err := r.handleJiraError("Issue.Search", resp, err, logger)
+		return nil, retry, err
+	}
+	if len(issues) == 0 {
+		level.Debug(logger).Log("msg", "  no results", "query", query)
+		return nil, false, nil
+	}
+
+	issue := &issues[0]
+	level.Info(logger).Log("msg", "precondition matched existing issue, not creating new issue", "key", issue.Key, "query", query)
+	if r.conf.PreconditionComment != "" {
+		body := r.tmpl.Execute(r.conf.PreconditionComment, data, logger)
+		if err := r.tmpl.Err(); err != nil {
+			return nil, false, err
+		}
+		if retry, err := r.addComment(issue.Key, body, logger); err != nil {
+			return nil, retry, err
+		}
+	}
+	return issue, false, nil
+}
+
+// searchSummary returns an unresolved issue in the project whose summary is the one the issue would be created with,
+// ignoring the alert count suffix, if any.
+func (r *Receiver) searchSummary(project string, data *alertmanager.Data, logger log.Logger) (*jira.Issue, bool, error) {
+	summary, _ := r.renderSummaryParts(data, logger)
+	if err := r.tmpl.Err(); err != nil {
+		return nil, false, &NotifyError{ErrorValidation, err}
+	}
+	// Summary only supports (tokenized) phrase searches, so search for its words and compare the matches. The last
+	// word is left out of long summaries, in case it was cut short to fit the existing issue's alert count.
+	words := dedupWordsRE.FindAllString(summary, -1)
+	if utf8.RuneCountInString(summary) > maxSummaryLength-len(" (10000 alerts)") && len(words) > 1 {
+		words = words[:len(words)-1]
+	}
+	phrase := `"` + strings.Join(words, " ") + `"`
+	query := fmt.Sprintf(`project="%s" and statusCategory != Done and summary ~ "%s" order by created desc`,
+		template.JQLEscape(project), template.JQLEscape(phrase))
+
+	level.Debug(logger).Log("msg", "summary search", "query", query)
+	issues, resp, err := r.client.Issue.Search(query, &jira.SearchOptions{Fields: []string{"summary", "labels"}, MaxResults: 10})
+	if err != nil {
+		retry, err := r.handleJiraError("Issue.Search", resp, err, logger)
+		return nil, retry, err
+	}
+	for i := range issues {
+		if issues[i].Fields != nil && r.sameSummary(issues[i].Fields.Summary, summary) {
+			level.Debug(logger).Log("msg", "  found", "key", issues[i].Key, "query", query)
+			return &issues[i], false, nil
+		}
+	}
+	level.Debug(logger).Log("msg", "  no results", "query", query)
+	return nil, false, nil
+}
+
+// adopt makes an existing issue the one of the alert group, by storing the dedup key on it, so further notifications
+// find it.
+func (r *Receiver) adopt(issue *jira.Issue, issueLabel string, data *alertmanager.Data, logger log.Logger) (bool, error) {
+	level.Info(logger).Log("msg", "unresolved issue with the same summary found, updating it instead of creating new issue", "key", issue.Key, "label", issueLabel)
+	update := map[string]interface{}{"update": map[string]interface{}{"labels": []map[string]string{{"add": issueLabel}}}}
+	if r.conf.DedupField != "" {
+		update = map[string]interface{}{"fields": map[string]interface{}{r.conf.DedupField: issueLabel}}
+	}
+	resp, err := r.client.Issue.UpdateIssue(issue.Key, update)
+	if err != nil {
+		return r.handleJiraError("Issue.UpdateIssue", resp, err, logger)
+	}
+	r.audit(auditUpdate, data, issue.Key, logger)
+	return false, nil
+}
+
+func (r *Receiver) addComment(issueKey, body string, logger log.Logger) (bool, error) {
+	level.Debug(logger).Log("msg", "add comment", "key", issueKey)
+	var resp *jira.Response
+	var err error
+	if r.conf.APIVersion == "3" {
+		// API v3 only accepts comment bodies in Atlassian Document Format.
+		comment := map[string]interface{}{"body": toADF(body)}
+		if v := r.conf.CommentVisibility; v != nil {
+			comment["visibility"] = map[string]string{"type": v.Type, "value": v.Value}
+		}
+		var req *http.Request
+		req, err = r.client.NewRequest("POST", "rest/api/2/issue/"+url.PathEscape(issueKey)+"/comment", comment)
+		if err != nil {
+			return false, err
+		}
+		// Decoded only so the response body is closed.
+		var created struct {
+			ID string `json:"id"`
+		}
+		resp, err = r.client.Do(req, &created)
+	} else {
+		comment := &jira.Comment{Body: body}
+		if v := r.conf.CommentVisibility; v != nil {
+			comment.Visibility = jira.CommentVisibility{Type: v.Type, Value: v.Value}
+		}
+		_, resp, err = r.client.Issue.AddComment(issueKey, comment)
+	}
+	if err != nil {
+		return r.handleJiraError("Issue.AddComment", resp, err, logger)
+	}
+
+	level.Debug(logger).Log("msg", "  done")
+	return false, nil
+}
+
+// reopenable returns whether an issue resolved at the given time is to be reopened rather than replaced by a new one:
+// it must have been resolved within reopen_duration and, if set, within reopen_max_age.
+func (r *Receiver) reopenable(resolved, now time.Time) bool {
+	if !resolved.Add(time.Duration(*r.conf.ReopenDuration)).After(now) {
+		return false
+	}
+	return r.conf.ReopenMaxAge == nil || resolved.Add(time.Duration(*r.conf.ReopenMaxAge)).After(now)
+}
+
 func (r *Receiver) reopen(issueKey string, logger log.Logger) (bool, error) {
-	transitions, resp, err := r.client.Issue.GetTransitions(issueKey)
+	// Matched by exact name, as always for reopen_state.
+	return r.transition(issueKey, r.conf.ReopenState, true, logger)
+}
+
+// transition performs the transition of the issue with the given ID or (case insensitive) name, or only the given
+// exact name.
+func (r *Receiver) transition(issueKey, transition string, exact bool, logger log.Logger) (bool, error) {
+	t, names, retry, err := r.findTransition(issueKey, transition, exact, logger)
 	if err != nil {
-		return handleJiraError("Issue.GetTransitions", resp, err, logger)
+		return retry, err
 	}
-	for _, t := range transitions {
-		if t.Name == r.conf.ReopenState {
-			level.Debug(logger).Log("msg", "reopen", "key", issueKey, "transitionID", t.ID)
-			resp, err = r.client.Issue.DoTransition(issueKey, t.ID)
-			if err != nil {
-				return handleJiraError("Issue.DoTransition", resp, err, logger)
-			}
+	if t == nil {
+		return false, fmt.Errorf("JIRA transition %q does not exist or is not possible for %s, available transitions: %s", transition, issueKey, strings.Join(names, ", "))
+	}
+	return r.doTransition(issueKey, t, logger)
+}
 
-			level.Debug(logger).Log("msg", "  done")
-			return false, nil
+// statusTransition performs the StatusTransitions transition for the status of the alert group, if the workflow
+// currently allows it. Otherwise the issue is assumed to be past it already, e.g. transitioned on an earlier
+// notification or by hand.
+func (r *Receiver) statusTransition(issueKey, status, transition string, data *alertmanager.Data, logger log.Logger) (bool, error) {
+	t, names, retry, err := r.findTransition(issueKey, transition, false, logger)
+	if err != nil {
+		return retry, err
+	}
+	if t == nil {
+		level.Debug(logger).Log("msg", "status transition not possible for issue, skipping", "key", issueKey, "status", status, "transition", transition, "available", strings.Join(names, ", "))
+		return false, nil
+	}
+	level.Info(logger).Log("msg", "transitioning issue for alert group status", "key", issueKey, "status", status, "transition", t.Name)
+	retry, err = r.doTransition(issueKey, t, logger)
+	if err == nil {
+		action := auditUpdate
+		if status == alertmanager.AlertResolved {
+			action = auditResolve
+		}
+		r.audit(action, data, issueKey, logger)
+	}
+	return retry, err
+}
+
+// findTransition returns the transition of the issue with the given ID or (case insensitive) name, or only the given
+// exact name, or nil and the quoted names of the available transitions.
+func (r *Receiver) findTransition(issueKey, transition string, exact bool, logger log.Logger) (*jira.Transition, []string, bool, error) {
+	transitions, resp, err := r.client.Issue.GetTransitions(issueKey)
+	if err != nil {
+		retry, err := r.handleJiraError("Issue.GetTransitions", resp, err, logger)
+		return nil, nil, retry, err
+	}
+	names := make([]string, 0, len(transitions))
+	for i, t := range transitions {
+		if t.Name == transition || (!exact && (t.ID == transition || strings.EqualFold(t.Name, transition))) {
+			return &transitions[i], nil, false, nil
 		}
+		names = append(names, fmt.Sprintf("%q", t.Name))
 	}
-	return false, fmt.Errorf("JIRA state %q does not exist or no transition possible for %s", r.conf.ReopenState, issueKey)
+	return nil, names, false, nil
+}
+
+func (r *Receiver) doTransition(issueKey string, t *jira.Transition, logger log.Logger) (bool, error) {
+	level.Debug(logger).Log("msg", "transition", "key", issueKey, "transition", t.Name, "transitionID", t.ID)
+	resp, err := r.client.Issue.DoTransition(issueKey, t.ID)
+	if err != nil {
+		return r.handleJiraError("Issue.DoTransition", resp, err, logger)
+	}
+
+	level.Debug(logger).Log("msg", "  done")
+	return false, nil
 }
 
 func (r *Receiver) create(issue *jira.Issue, logger log.Logger) (bool, error) {
 	level.Debug(logger).Log("msg", "create", "issue", *issue)
 	newIssue, resp, err := r.client.Issue.Create(issue)
+	if err != nil && r.conf.DropInvalidFields && resp != nil && resp.StatusCode == http.StatusBadRequest {
+		if dropped := r.dropInvalidFields(issue, resp); len(dropped) > 0 {
+			level.Warn(logger).Log("msg", "JIRA rejected fields, creating issue without them", "fields", strings.Join(dropped, ", "))
+			droppedFieldsTotal.WithLabelValues(r.conf.Name).Add(float64(len(dropped)))
+			newIssue, resp, err = r.client.Issue.Create(issue)
+		}
+	}
 	if err != nil {
-		return handleJiraError("Issue.Create", resp, err, logger)
+		return r.handleJiraError("Issue.Create", resp, err, logger)
 	}
 	*issue = *newIssue
 
@@ -237,18 +1515,129 @@ func (r *Receiver) create(issue *jira.Issue, logger log.Logger) (bool, error) {
 	return false, nil
 }
 
-func handleJiraError(api string, resp *jira.Response, err error, logger log.Logger) (bool, error) {
+// waitForIssue fetches a newly created issue until JIRA finds it, for at most timeout.
+func (r *Receiver) waitForIssue(issueKey string, timeout time.Duration, logger log.Logger) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		_, resp, err := r.client.Issue.Get(issueKey, &jira.GetQueryOptions{Fields: "summary"})
+		if err == nil {
+			level.Debug(logger).Log("msg", "created issue is retrievable", "key", issueKey)
+			return nil
+		}
+		if resp == nil || resp.StatusCode != http.StatusNotFound {
+			_, err := r.handleJiraError("Issue.Get", resp, err, logger)
+			return err
+		}
+		if time.Now().Add(waitForIssueDelay).After(deadline) {
+			return fmt.Errorf("issue %s not retrievable after %s", issueKey, timeout)
+		}
+		time.Sleep(waitForIssueDelay)
+	}
+}
+
+// dropInvalidFields removes the fields named in the errors of a 400 Bad Request response from the issue and returns
+// their names. Only custom fields are dropped, except the dedup field, standard fields being essential. The response
+// body remains readable.
+func (r *Receiver) dropInvalidFields(issue *jira.Issue, resp *jira.Response) []string {
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	var jerr struct {
+		Errors map[string]string `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &jerr); err != nil {
+		return nil
+	}
+	var dropped []string
+	for field, msg := range jerr.Errors {
+		if _, ok := issue.Fields.Unknowns[field]; ok && field != "description" && field != r.conf.DedupField {
+			delete(issue.Fields.Unknowns, field)
+			dropped = append(dropped, fmt.Sprintf("%s (%s)", field, msg))
+		}
+	}
+	sort.Strings(dropped)
+	return dropped
+}
+
+// CheckAuth fetches the authenticated user from JIRA, to verify the receiver's API URL and credentials.
+func (r *Receiver) CheckAuth(logger log.Logger) error {
+	_, resp, err := r.client.User.GetSelf()
+	if err != nil {
+		_, err = r.handleJiraError("User.GetSelf", resp, err, logger)
+		return err
+	}
+	return nil
+}
+
+func (r *Receiver) attach(issueKey, name, content string, logger log.Logger) (bool, error) {
+	level.Debug(logger).Log("msg", "attach", "key", issueKey, "name", name, "size", len(content))
+	_, resp, err := r.client.Issue.PostAttachment(issueKey, strings.NewReader(content), name)
+	if err != nil {
+		return r.handleJiraError("Issue.PostAttachment", resp, err, logger)
+	}
+
+	level.Debug(logger).Log("msg", "  done", "key", issueKey, "name", name)
+	return false, nil
+}
+
+// addRemoteLinks links the issue to the distinct generator URLs of the alerts, titled with their alert names.
+func (r *Receiver) addRemoteLinks(issueKey string, data *alertmanager.Data, logger log.Logger) (bool, error) {
+	seen := map[string]bool{}
+	for _, a := range data.Alerts {
+		if a.GeneratorURL == "" || seen[a.GeneratorURL] {
+			continue
+		}
+		seen[a.GeneratorURL] = true
+		title := a.Labels["alertname"]
+		if title == "" {
+			title = a.GeneratorURL
+		}
+		level.Debug(logger).Log("msg", "add remote link", "key", issueKey, "url", a.GeneratorURL)
+		link := &jira.RemoteLink{
+			// Makes JIRA update rather than duplicate the link, should it be added again.
+			GlobalID: a.GeneratorURL,
+			Object:   &jira.RemoteLinkObject{URL: a.GeneratorURL, Title: title},
+		}
+		if _, resp, err := r.client.Issue.AddRemoteLink(issueKey, link); err != nil {
+			return r.handleJiraError("Issue.AddRemoteLink", resp, err, logger)
+		}
+	}
+	return false, nil
+}
+
+func (r *Receiver) handleJiraError(api string, resp *jira.Response, err error, logger log.Logger) (bool, error) {
 	if resp == nil || resp.Request == nil {
 		level.Debug(logger).Log("msg", "handleJiraError", "api", api, "err", err)
 	} else {
 		level.Debug(logger).Log("msg", "handleJiraError", "api", api, "err", err, "url", resp.Request.URL)
 	}
 
+	if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+		// Retrying with the same credentials won't help.
+		authErrorsTotal.WithLabelValues(r.conf.Name).Inc()
+		return false, &NotifyError{ErrorAuth, fmt.Errorf("JIRA authentication failed for user %q%s: %s returned status %s", r.conf.User, r.impersonationHint(), api, resp.Status)}
+	}
 	if resp != nil && resp.StatusCode/100 != 2 {
-		retry := resp.StatusCode == 500 || resp.StatusCode == 503
+		kind := ErrorUnknown
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			kind = ErrorRateLimit
+		case resp.StatusCode == 500 || resp.StatusCode == 502 || resp.StatusCode == 503 || resp.StatusCode == 504:
+			kind = ErrorTransient
+		case resp.StatusCode/100 == 4:
+			kind = ErrorValidation
+		}
+		retry := kind == ErrorTransient || kind == ErrorRateLimit
 		body, _ := ioutil.ReadAll(resp.Body)
 		// go-jira error message is not particularly helpful, replace it
-		return retry, fmt.Errorf("JIRA request %s returned status %s, body %q", resp.Request.URL, resp.Status, string(body))
+		err = fmt.Errorf("JIRA request %s returned status %s%s, body %q", resp.Request.URL, resp.Status, r.impersonationHint(), string(body))
+		if resp.StatusCode == http.StatusNotFound {
+			err = &notFoundError{err}
+		}
+		return retry, &NotifyError{kind, err}
+	}
+	if resp == nil {
+		// No response at all, e.g. a refused connection or a timeout.
+		return true, &NotifyError{ErrorTransient, fmt.Errorf("JIRA request %s failed: %s", api, err)}
 	}
 	return false, fmt.Errorf("JIRA request %s failed: %s", api, err)
 }
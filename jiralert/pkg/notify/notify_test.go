@@ -0,0 +1,1073 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/config"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/template"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitLabelLength(t *testing.T) {
+	var (
+		atLimit   = strings.Repeat("a", maxLabelLength)
+		overLimit = strings.Repeat("b", maxLabelLength+1)
+		multibyte = strings.Repeat("ü", maxLabelLength)
+	)
+
+	labels, affected := limitLabelLength([]string{"short", atLimit, overLimit, multibyte}, false)
+	require.Equal(t, []string{"short", atLimit, overLimit[:maxLabelLength], multibyte}, labels)
+	require.Equal(t, []string{overLimit}, affected)
+
+	labels, affected = limitLabelLength([]string{"short", atLimit, overLimit, multibyte}, true)
+	require.Equal(t, []string{"short", atLimit, multibyte}, labels)
+	require.Equal(t, []string{overLimit}, affected)
+}
+
+func TestSanitizeLabel(t *testing.T) {
+	require.Equal(t, "team_payments_eu_west", sanitizeLabel("team_payments eu\twest"))
+	require.Equal(t, "critical", sanitizeLabel(" critical "))
+}
+
+func TestTruncateRunes(t *testing.T) {
+	require.Equal(t, "äöü", truncateRunes("äöü", 3, "..."))
+	require.Equal(t, "ä...", truncateRunes("äöüß!", 4, "..."))
+	require.Equal(t, "äö", truncateRunes("äöüß!", 2, "..."))
+}
+
+func TestMarkdownToWiki(t *testing.T) {
+	md := strings.Join([]string{
+		"# Disk full on `host1`",
+		"### Details ###",
+		"See the **runbook** at [wiki](https://wiki.example.com/disk), *now*.",
+		"- first",
+		"  - nested with ~~old~~ __new__ text",
+		"1. step one",
+		"2. step two",
+		"> quoted",
+		"---",
+		"```bash",
+		"# not a heading",
+		"df -h **not bold**",
+		"```",
+	}, "\n")
+	require.Equal(t, strings.Join([]string{
+		"h1. Disk full on {{host1}}",
+		"h3. Details",
+		"See the *runbook* at [wiki|https://wiki.example.com/disk], _now_.",
+		"* first",
+		"** nested with -old- *new* text",
+		"# step one",
+		"# step two",
+		"bq. quoted",
+		"----",
+		"{code:bash}",
+		"# not a heading",
+		"df -h **not bold**",
+		"{code}",
+	}, "\n"), markdownToWiki(md))
+}
+
+func TestIsEmptyValue(t *testing.T) {
+	require.True(t, isEmptyValue(" \n"))
+	require.True(t, isEmptyValue(map[string]interface{}{"value": ""}))
+	require.True(t, isEmptyValue([]interface{}{map[string]interface{}{"value": " "}}))
+	require.False(t, isEmptyValue(map[string]interface{}{"value": "red"}))
+	require.False(t, isEmptyValue(0))
+}
+
+func TestLabelDiff(t *testing.T) {
+	managed := func(l string) bool { return strings.HasPrefix(l, "team_") }
+
+	add, remove := labelDiff(
+		[]string{`ALERT{alertname="Disk"}`, "team_db", "team_web", "manual"},
+		[]string{"team_db", "team_api", "team_api"},
+		managed, `ALERT{alertname="Disk"}`)
+	require.Equal(t, []string{"team_api"}, add)
+	require.Equal(t, []string{"team_web"}, remove)
+
+	// The reserved label is kept even if it looks managed.
+	add, remove = labelDiff([]string{"team_reserved"}, nil, managed, "team_reserved")
+	require.Empty(t, add)
+	require.Empty(t, remove)
+}
+
+func TestLimitLabelCount(t *testing.T) {
+	labels := []string{"team_db", "ALERT{}", "a", "static", "b"}
+
+	kept, dropped := limitLabelCount(labels, 3, []string{"ALERT{}", "static", "missing"})
+	require.Equal(t, []string{"ALERT{}", "static", "team_db"}, kept)
+	require.Equal(t, []string{"a", "b"}, dropped)
+
+	kept, dropped = limitLabelCount(labels, 5, []string{"static"})
+	require.Equal(t, labels, kept)
+	require.Empty(t, dropped)
+}
+
+func TestHandleJiraErrorKind(t *testing.T) {
+	r := &Receiver{conf: &config.ReceiverConfig{Name: "test"}}
+	req, err := http.NewRequest("GET", "https://jira.example.com/rest/api/2/search", nil)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		status int
+		retry  bool
+		kind   ErrorKind
+	}{
+		{status: 401, kind: ErrorAuth},
+		{status: 400, kind: ErrorValidation},
+		{status: 429, retry: true, kind: ErrorRateLimit},
+		{status: 503, retry: true, kind: ErrorTransient},
+		{status: 502, retry: true, kind: ErrorTransient},
+		{status: 504, retry: true, kind: ErrorTransient},
+		{status: 501, kind: ErrorUnknown},
+	} {
+		resp := &jira.Response{Response: &http.Response{
+			StatusCode: tc.status,
+			Status:     http.StatusText(tc.status),
+			Request:    req,
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}}
+		retry, err := r.handleJiraError("Issue.Search", resp, errors.New("failed"), log.NewNopLogger())
+		require.Equal(t, tc.retry, retry, "status %d", tc.status)
+		require.Equal(t, tc.kind, ErrorKindOf(err), "status %d", tc.status)
+		require.Equal(t, tc.kind, ErrorKindOf(fmt.Errorf("wrapped: %w", err)), "status %d", tc.status)
+	}
+	require.Equal(t, ErrorUnknown, ErrorKindOf(errors.New("plain")))
+
+	retry, err := r.handleJiraError("Issue.Search", nil, errors.New("connection refused"), log.NewNopLogger())
+	require.True(t, retry)
+	require.Equal(t, ErrorTransient, ErrorKindOf(err))
+}
+
+func TestAlertsCSV(t *testing.T) {
+	data := &alertmanager.Data{
+		Alerts: alertmanager.Alerts{
+			{Status: "firing", Labels: alertmanager.KV{"alertname": "Down", "instance": "a:9100"}, StartsAt: time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC), Fingerprint: "f1"},
+			{Status: "resolved", Labels: alertmanager.KV{"alertname": "Down", "job": "node, exporter"}, StartsAt: time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC), EndsAt: time.Date(2021, 3, 1, 11, 0, 0, 0, time.UTC), Fingerprint: "f2"},
+		},
+		CommonLabels: alertmanager.KV{"alertname": "Down"},
+	}
+	out, err := alertsCSV(data)
+	require.NoError(t, err)
+	require.Equal(t, `status,startsAt,endsAt,fingerprint,alertname,instance,job
+firing,2021-03-01T10:00:00Z,,f1,Down,a:9100,
+resolved,2021-03-01T09:00:00Z,2021-03-01T11:00:00Z,f2,Down,,"node, exporter"
+`, out)
+}
+
+func TestRecentCache(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	c := newRecentCache(2, time.Hour)
+
+	c.Add("a", "AB-1", now)
+	c.Add("b", "AB-2", now.Add(time.Minute))
+	_, ok := c.Get("a", now.Add(2*time.Minute))
+	require.True(t, ok)
+	// "b" is the least recently used.
+	c.Add("c", "AB-3", now.Add(3*time.Minute))
+	_, ok = c.Get("b", now.Add(3*time.Minute))
+	require.False(t, ok)
+	e, ok := c.Get("c", now.Add(3*time.Minute))
+	require.True(t, ok)
+	require.Equal(t, "AB-3", e.issueKey)
+
+	// Expired on Get, though recently used.
+	_, ok = c.Get("a", now.Add(time.Hour))
+	require.False(t, ok)
+	require.Equal(t, 1, c.order.Len())
+
+	// Expired entries are dropped on Add.
+	c.Add("d", "AB-4", now.Add(2*time.Hour))
+	require.Equal(t, 1, c.order.Len())
+	_, ok = c.Get("c", now.Add(2*time.Hour))
+	require.False(t, ok)
+}
+
+func TestDropInvalidFields(t *testing.T) {
+	r := &Receiver{conf: &config.ReceiverConfig{Name: "test", DedupField: "customfield_10006"}}
+	issue := &jira.Issue{Fields: &jira.IssueFields{Unknowns: map[string]interface{}{
+		"customfield_10001": "text",
+		"customfield_10002": map[string]string{"value": "red"},
+		"customfield_10006": "ALERT{}",
+	}}}
+	body := `{"errorMessages":[],"errors":{"customfield_10002":"Option 'red' is not valid","customfield_10006":"Too long","priority":"Invalid"}}`
+	resp := &jira.Response{Response: &http.Response{StatusCode: 400, Body: ioutil.NopCloser(strings.NewReader(body))}}
+
+	require.Equal(t, []string{"customfield_10002 (Option 'red' is not valid)"}, r.dropInvalidFields(issue, resp))
+	require.Equal(t, map[string]interface{}{"customfield_10001": "text", "customfield_10006": "ALERT{}"}, map[string]interface{}(issue.Fields.Unknowns))
+	rest, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, body, string(rest))
+}
+
+func TestAnnotationContent(t *testing.T) {
+	r := &Receiver{conf: &config.ReceiverConfig{AnnotationPrefix: "jira_"}}
+	data := &alertmanager.Data{CommonAnnotations: alertmanager.KV{"jira_summary": "Disk full on db-1"}}
+
+	v, ok := r.annotationContent(defaultSummaryTemplate, defaultSummaryTemplate, "summary", data)
+	require.True(t, ok)
+	require.Equal(t, "Disk full on db-1", v)
+
+	_, ok = r.annotationContent(`{{ .GroupLabels.alertname }}`, defaultSummaryTemplate, "summary", data)
+	require.False(t, ok)
+	_, ok = r.annotationContent(defaultDescriptionTemplate, defaultDescriptionTemplate, "description", data)
+	require.False(t, ok)
+}
+
+func TestAudit(t *testing.T) {
+	defer func() { AuditLog = nil }()
+	var b strings.Builder
+	AuditLog = NewAuditWriter(&b, true)
+
+	r := &Receiver{conf: &config.ReceiverConfig{Name: "test"}}
+	r.audit(auditCreate, &alertmanager.Data{GroupKey: `{}:{alertname="Down"}`}, "ABC-1", log.NewNopLogger())
+	r.audit(auditResolve, &alertmanager.Data{GroupKey: `{}:{alertname="Down"}`}, "ABC-1", log.NewNopLogger())
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	var rec auditRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &rec))
+	require.Equal(t, auditResolve, rec.Action)
+	require.Equal(t, "test", rec.Receiver)
+	require.Equal(t, `{}:{alertname="Down"}`, rec.GroupKey)
+	require.Equal(t, "ABC-1", rec.IssueKey)
+	require.False(t, rec.Time.IsZero())
+}
+
+func TestDedupKeyTemplate(t *testing.T) {
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	r := &Receiver{conf: &config.ReceiverConfig{DedupKeyTemplate: `{{ .CommonAnnotations.incident }}`}, tmpl: tmpl}
+
+	a, err := r.dedupKey(&alertmanager.Data{GroupLabels: alertmanager.KV{"alertname": "Down"}, CommonAnnotations: alertmanager.KV{"incident": "db"}}, logger)
+	require.NoError(t, err)
+	require.Regexp(t, `^ALERT\{[0-9a-f]{16}\}$`, a)
+	b, err := r.dedupKey(&alertmanager.Data{GroupLabels: alertmanager.KV{"alertname": "Slow"}, CommonAnnotations: alertmanager.KV{"incident": "db"}}, logger)
+	require.NoError(t, err)
+	require.Equal(t, a, b)
+
+	_, err = r.dedupKey(&alertmanager.Data{GroupLabels: alertmanager.KV{"alertname": "Down"}}, logger)
+	require.Error(t, err)
+	require.Equal(t, ErrorValidation, ErrorKindOf(err))
+}
+
+func TestResolveDelay(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	data := &alertmanager.Data{Alerts: alertmanager.Alerts{
+		{EndsAt: now.Add(-4 * time.Minute)},
+		{EndsAt: now.Add(-time.Minute)},
+	}}
+	require.Equal(t, 4*time.Minute, resolveDelay(data, 5*time.Minute, now))
+	require.True(t, resolveDelay(data, time.Minute, now) <= 0)
+	require.Equal(t, time.Minute, resolveDelay(&alertmanager.Data{Alerts: alertmanager.Alerts{{}}}, time.Minute, now))
+}
+
+func TestAssignOnCall(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.URL.Path != "/teams/db" {
+			http.Error(w, "unknown team", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"assignee": "alice"}`)
+	}))
+	defer srv.Close()
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	timeout, ttl := config.Duration(time.Second), config.Duration(time.Minute)
+	r := &Receiver{conf: &config.ReceiverConfig{
+		Name:     "oncall",
+		Assignee: "bob",
+		OnCall:   &config.OnCallConfig{URL: srv.URL + "/teams/{{ .CommonLabels.team }}", Field: "assignee", Timeout: &timeout, CacheTTL: &ttl},
+	}, tmpl: tmpl}
+
+	for i := 0; i < 2; i++ {
+		issue := &jira.Issue{Fields: &jira.IssueFields{}}
+		require.NoError(t, r.assign(issue, &alertmanager.Data{CommonLabels: alertmanager.KV{"team": "db"}}, logger))
+		require.Equal(t, "alice", issue.Fields.Assignee.Name)
+	}
+	require.Equal(t, 1, requests)
+
+	issue := &jira.Issue{Fields: &jira.IssueFields{}}
+	require.NoError(t, r.assign(issue, &alertmanager.Data{CommonLabels: alertmanager.KV{"team": "web"}}, logger))
+	require.Equal(t, "bob", issue.Fields.Assignee.Name)
+}
+
+func TestReopenable(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	reopenDuration, maxAge := config.Duration(90*24*time.Hour), config.Duration(7*24*time.Hour)
+	r := &Receiver{conf: &config.ReceiverConfig{ReopenDuration: &reopenDuration}}
+	require.True(t, r.reopenable(now.Add(-30*24*time.Hour), now))
+
+	r.conf.ReopenMaxAge = &maxAge
+	require.True(t, r.reopenable(now.Add(-7*24*time.Hour+time.Second), now))
+	require.False(t, r.reopenable(now.Add(-7*24*time.Hour), now))
+	require.False(t, r.reopenable(now.Add(-30*24*time.Hour), now))
+
+	// The shorter of both bounds applies.
+	reopenDuration = config.Duration(time.Hour)
+	require.False(t, r.reopenable(now.Add(-2*time.Hour), now))
+	require.True(t, r.reopenable(now.Add(-time.Hour+time.Second), now))
+}
+
+func TestEscalationPriority(t *testing.T) {
+	r := &Receiver{conf: &config.ReceiverConfig{EscalatePriority: map[int]string{5: "High", 20: "Highest"}}}
+	firing := func(n int) *alertmanager.Data {
+		data := &alertmanager.Data{}
+		for i := 0; i < n; i++ {
+			data.Alerts = append(data.Alerts, alertmanager.Alert{Status: alertmanager.AlertFiring})
+		}
+		data.Alerts = append(data.Alerts, alertmanager.Alert{Status: alertmanager.AlertResolved})
+		return data
+	}
+	require.Equal(t, "", r.escalationPriority(firing(4)))
+	require.Equal(t, "High", r.escalationPriority(firing(5)))
+	require.Equal(t, "High", r.escalationPriority(firing(19)))
+	require.Equal(t, "Highest", r.escalationPriority(firing(20)))
+
+	priorities := []jira.Priority{{Name: "Highest"}, {Name: "High"}, {Name: "Medium"}}
+	require.Equal(t, 1, priorityRank(priorities, "high"))
+	require.Equal(t, -1, priorityRank(priorities, "Blocker"))
+}
+
+func TestToNumber(t *testing.T) {
+	v, err := toNumber(" 12345678901234567890 ")
+	require.NoError(t, err)
+	b, err := json.Marshal(map[string]interface{}{"points": v})
+	require.NoError(t, err)
+	require.Equal(t, `{"points":12345678901234567890}`, string(b))
+
+	v, err = toNumber("2.5")
+	require.NoError(t, err)
+	require.Equal(t, json.Number("2.5"), v)
+	v, err = toNumber(3)
+	require.NoError(t, err)
+	require.Equal(t, 3, v)
+	v, err = toNumber("")
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	v, err = toNumber("-1e6")
+	require.NoError(t, err)
+	require.Equal(t, json.Number("-1e6"), v)
+
+	_, err = toNumber("three")
+	require.EqualError(t, err, `rendered value "three" is not a number`)
+	for _, s := range []string{"NaN", "Inf", "+5", ".5", "5.", "05", "0x10", "1_000"} {
+		_, err = toNumber(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestFiringOnly(t *testing.T) {
+	data := &alertmanager.Data{
+		Alerts: alertmanager.Alerts{
+			{Status: alertmanager.AlertFiring, Labels: alertmanager.KV{"alertname": "Down", "zone": "a", "instance": "1"}, Annotations: alertmanager.KV{"team": "db"}},
+			{Status: alertmanager.AlertFiring, Labels: alertmanager.KV{"alertname": "Down", "zone": "a", "instance": "2"}, Annotations: alertmanager.KV{"team": "db"}},
+			{Status: alertmanager.AlertResolved, Labels: alertmanager.KV{"alertname": "Down", "zone": "b", "instance": "3"}},
+		},
+		CommonLabels: alertmanager.KV{"alertname": "Down"},
+	}
+	firing := firingOnly(data)
+	require.Len(t, firing.Alerts, 2)
+	require.Equal(t, alertmanager.KV{"alertname": "Down", "zone": "a"}, firing.CommonLabels)
+	require.Equal(t, alertmanager.KV{"team": "db"}, firing.CommonAnnotations)
+	require.Len(t, data.Alerts, 3)
+
+	resolved := &alertmanager.Data{Alerts: data.Alerts[2:]}
+	require.Equal(t, resolved, firingOnly(resolved))
+}
+
+func TestFieldContains(t *testing.T) {
+	require.True(t, fieldContains(map[string]interface{}{"value": "red", "id": "10001"}, map[string]interface{}{"value": "red"}))
+	require.False(t, fieldContains(map[string]interface{}{"value": "blue", "id": "10002"}, map[string]interface{}{"value": "red"}))
+	require.True(t, fieldContains([]interface{}{map[string]interface{}{"value": "red", "id": "1"}}, []interface{}{map[string]interface{}{"value": "red"}}))
+	require.False(t, fieldContains([]interface{}{}, []interface{}{map[string]interface{}{"value": "red"}}))
+	require.True(t, fieldContains("text", "text"))
+	require.False(t, fieldContains(nil, "text"))
+	require.True(t, fieldContains(float64(3), json.Number("3")))
+	require.True(t, fieldContains(float64(3), 3))
+}
+
+func TestRenderLabelsMultiline(t *testing.T) {
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	data := &alertmanager.Data{CommonAnnotations: alertmanager.KV{"jira_labels": "db, team a\n\n network\r\ndb\n"}}
+
+	r := &Receiver{conf: &config.ReceiverConfig{Labels: []string{`{{ .CommonAnnotations.jira_labels }}`}}, tmpl: tmpl}
+	require.Equal(t, []string{"db", "team_a_network_db"}, r.renderLabels(data, logger))
+
+	r.conf.LabelsMultiline = true
+	require.Equal(t, []string{"db", "team_a", "network"}, r.renderLabels(data, logger))
+}
+
+func TestHeartbeat(t *testing.T) {
+	comments := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "/rest/api/2/issue/HB-1/comment", req.URL.Path)
+		comments++
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": "1"}`))
+	}))
+	defer srv.Close()
+	client, err := jira.NewClient(nil, srv.URL)
+	require.NoError(t, err)
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	interval := config.Duration(time.Hour)
+	r := &Receiver{conf: &config.ReceiverConfig{Name: "heartbeat", HeartbeatComment: "Still firing.", HeartbeatInterval: &interval}, tmpl: tmpl, client: client}
+
+	now := time.Now()
+	for _, at := range []time.Time{now, now.Add(30 * time.Minute), now.Add(time.Hour)} {
+		_, err := r.heartbeat("HB-1", &alertmanager.Data{}, at, logger)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, comments)
+
+	// Another receiver's shorter interval doesn't expire this receiver's heartbeats.
+	short := config.Duration(time.Minute)
+	other := &Receiver{conf: &config.ReceiverConfig{Name: "other", HeartbeatComment: "Still firing.", HeartbeatInterval: &short}, tmpl: tmpl, client: client}
+	for _, at := range []time.Time{now.Add(time.Hour + 2*time.Minute), now.Add(time.Hour + 4*time.Minute)} {
+		_, err := other.heartbeat("HB-1", &alertmanager.Data{}, at, logger)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 4, comments)
+	_, err = r.heartbeat("HB-1", &alertmanager.Data{}, now.Add(time.Hour+5*time.Minute), logger)
+	require.NoError(t, err)
+	require.Equal(t, 4, comments)
+}
+
+func TestIssueGone(t *testing.T) {
+	logger := log.NewNopLogger()
+	r := &Receiver{conf: &config.ReceiverConfig{Name: "test"}}
+	req, err := http.NewRequest("POST", "https://jira.example.com/rest/api/2/issue/XY-1/transitions", nil)
+	require.NoError(t, err)
+	response := func(status int) *jira.Response {
+		return &jira.Response{Response: &http.Response{
+			StatusCode: status,
+			Status:     http.StatusText(status),
+			Request:    req,
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}}
+	}
+
+	_, notFound := r.handleJiraError("Issue.DoTransition", response(404), errors.New("failed"), logger)
+	require.Equal(t, ErrorValidation, ErrorKindOf(notFound))
+	_, badRequest := r.handleJiraError("Issue.DoTransition", response(400), errors.New("failed"), logger)
+	require.False(t, r.issueGone("XY-1", "ALERT{}", notFound, logger))
+
+	r.conf.RecreateOnMissing = true
+	require.True(t, r.issueGone("XY-1", "ALERT{}", notFound, logger))
+	require.True(t, r.issueGone("XY-1", "ALERT{}", fmt.Errorf("wrapped: %w", notFound), logger))
+	require.False(t, r.issueGone("XY-1", "ALERT{}", badRequest, logger))
+	require.False(t, r.issueGone("XY-1", "ALERT{}", nil, logger))
+}
+
+func TestImpersonate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Impersonate-User") != "db-bot" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"issues": []}`))
+	}))
+	defer srv.Close()
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	r, err := NewReceiver(&config.ReceiverConfig{
+		Name:              "test",
+		APIURL:            srv.URL,
+		Project:           "XY",
+		Impersonate:       `{{ .CommonLabels.team }}-bot`,
+		ImpersonateHeader: "X-Impersonate-User",
+	}, tmpl)
+	require.NoError(t, err)
+
+	r.impersonate = "db-bot"
+	issue, _, err := r.search("XY", "ALERT{}", logger)
+	require.NoError(t, err)
+	require.Nil(t, issue)
+
+	r.impersonate = "web-bot"
+	_, _, err = r.search("XY", "ALERT{}", logger)
+	require.Equal(t, ErrorAuth, ErrorKindOf(err))
+	require.Contains(t, err.Error(), `impersonating "web-bot" with X-Impersonate-User`)
+}
+
+func TestValidateJQL(t *testing.T) {
+	parse := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/rest/api/2/jql/parse" && parse:
+			var body struct{ Queries []string }
+			require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+			var errs []string
+			if strings.Contains(body.Queries[0], "AND AND") {
+				errs = []string{"Error in the JQL Query: expecting a field name."}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"queries": []interface{}{map[string]interface{}{"query": body.Queries[0], "errors": errs}}})
+		case req.URL.Path == "/rest/api/2/search":
+			if strings.Contains(req.URL.Query().Get("jql"), "AND AND") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"issues": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	r, err := NewReceiver(&config.ReceiverConfig{Name: "test", APIURL: srv.URL}, tmpl)
+	require.NoError(t, err)
+
+	for _, p := range []bool{true, false} {
+		parse = p
+		r.conf.PreconditionJQL = ""
+		require.NoError(t, r.ValidateJQL(logger))
+		r.conf.PreconditionJQL = `project = XY AND labels = "incident-{{ .CommonLabels.cluster | jqlEscape }}"`
+		require.NoError(t, r.ValidateJQL(logger), "parse %v", p)
+		r.conf.PreconditionJQL = `project = XY AND AND labels = "incident"`
+		require.Error(t, r.ValidateJQL(logger), "parse %v", p)
+	}
+}
+
+func TestAcquireSlot(t *testing.T) {
+	ConfigureConcurrency(2, map[string]int{"https://jira-a.example.com": 1})
+	defer ConfigureConcurrency(0, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	releaseA, err := acquireSlot(ctx, "https://jira-a.example.com")
+	require.NoError(t, err)
+	_, err = acquireSlot(ctx, "https://jira-a.example.com")
+	require.Error(t, err)
+	releaseA()
+	releaseA, err = acquireSlot(context.Background(), "https://jira-a.example.com")
+	require.NoError(t, err)
+	defer releaseA()
+
+	for i := 0; i < 2; i++ {
+		release, err := acquireSlot(context.Background(), "https://jira-b.example.com")
+		require.NoError(t, err)
+		defer release()
+	}
+	_, err = acquireSlot(ctx, "https://jira-b.example.com")
+	require.Error(t, err)
+}
+
+func TestFetchImage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/render/panel":
+			require.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("\x89PNG"))
+		case "/login":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html></html>"))
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+	logger := log.NewNopLogger()
+	headers := map[string]config.Secret{"Authorization": "Bearer token"}
+
+	image, err := fetchImage(srv.URL+"/render/panel", headers, time.Second, logger)
+	require.NoError(t, err)
+	require.Equal(t, "\x89PNG", image)
+	_, err = fetchImage(srv.URL+"/login", headers, time.Second, logger)
+	require.Error(t, err)
+	_, err = fetchImage(srv.URL+"/slow", headers, 10*time.Millisecond, logger)
+	require.Error(t, err)
+}
+
+func TestStableGroupLabels(t *testing.T) {
+	logger := log.NewNopLogger()
+	first := &alertmanager.Data{GroupLabels: alertmanager.KV{"alertname": "Down", "service": "db", "pod": "db-7f9c-x2"}}
+	second := &alertmanager.Data{GroupLabels: alertmanager.KV{"alertname": "Down", "service": "db", "pod": "db-7f9c-k8"}}
+
+	for _, conf := range []*config.ReceiverConfig{
+		{DedupLabels: []string{"alertname", "service", "cluster"}},
+		{DedupIgnoreLabels: []string{"pod"}},
+	} {
+		r := &Receiver{conf: conf}
+		a, err := r.dedupKey(first, logger)
+		require.NoError(t, err)
+		require.Equal(t, `ALERT{alertname="Down",service="db"}`, a)
+		b, err := r.dedupKey(second, logger)
+		require.NoError(t, err)
+		require.Equal(t, a, b)
+	}
+
+	r := &Receiver{conf: &config.ReceiverConfig{DedupLabels: []string{"cluster"}}}
+	_, err := r.dedupKey(first, logger)
+	require.Equal(t, ErrorValidation, ErrorKindOf(err))
+
+	r = &Receiver{conf: &config.ReceiverConfig{}}
+	a, err := r.dedupKey(first, logger)
+	require.NoError(t, err)
+	require.Equal(t, `ALERT{alertname="Down",pod="db-7f9c-x2",service="db"}`, a)
+}
+
+// fakeJira serves the parts of the JIRA REST API needed to create and comment issues, recording them. Searches find
+// nothing, as if JIRA's index lagged behind.
+type fakeJira struct {
+	sync.Mutex
+	created  []map[string]interface{}
+	comments []string
+}
+
+func (f *fakeJira) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/search"):
+		_, _ = w.Write([]byte(`{"issues": []}`))
+	case strings.Contains(req.URL.Path, "/project/"):
+		_, _ = w.Write([]byte(`{"key": "XY", "issueTypes": [{"id": "1", "name": "Task"}]}`))
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/issue"):
+		var issue map[string]interface{}
+		_ = json.NewDecoder(req.Body).Decode(&issue)
+		f.created = append(f.created, issue["fields"].(map[string]interface{}))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id": "%d", "key": "XY-%d"}`, len(f.created), len(f.created))
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/comment"):
+		body, _ := ioutil.ReadAll(req.Body)
+		f.comments = append(f.comments, req.URL.Path+" "+string(body))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": "1"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// busyLocker is a Locker whose locks are always held by another replica.
+type busyLocker struct{}
+
+func (busyLocker) TryLock(string) (func(), bool, error) {
+	return func() {}, false, nil
+}
+
+func TestNotifyDigest(t *testing.T) {
+	fake := &fakeJira{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	r, err := NewReceiver(&config.ReceiverConfig{
+		Name:      "digest",
+		APIURL:    srv.URL,
+		Project:   "XY",
+		IssueType: "Task",
+		Summary:   `{{ .CommonLabels.alertname }}`,
+		Digest:    &config.DigestConfig{},
+	}, tmpl)
+	require.NoError(t, err)
+	data := &alertmanager.Data{Status: alertmanager.AlertFiring, GroupLabels: alertmanager.KV{"alertname": "Down"}, CommonLabels: alertmanager.KV{"alertname": "Down"}}
+
+	for i := 0; i < 2; i++ {
+		_, err := r.Notify(data, logger)
+		require.NoError(t, err)
+		require.Equal(t, "XY-1", r.IssueKey())
+	}
+	require.Len(t, fake.created, 1)
+	require.Len(t, fake.comments, 2)
+
+	ReplicaLock = busyLocker{}
+	defer func() { ReplicaLock = noopLocker{} }()
+	retry, err := r.Notify(data, logger)
+	require.True(t, retry)
+	require.Equal(t, ErrorTransient, ErrorKindOf(err))
+	require.Len(t, fake.comments, 2)
+}
+
+func TestAddCommentADF(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "/rest/api/3/issue/XY-1/comment", req.URL.Path)
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": "1"}`))
+	}))
+	defer srv.Close()
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	r, err := NewReceiver(&config.ReceiverConfig{
+		Name:              "test",
+		APIURL:            srv.URL,
+		APIVersion:        "3",
+		CommentVisibility: &config.CommentVisibility{Type: "role", Value: "Developers"},
+	}, tmpl)
+	require.NoError(t, err)
+
+	_, err = r.addComment("XY-1", "Still firing.", logger)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"type": "role", "value": "Developers"}, body["visibility"])
+	doc, ok := body["body"].(map[string]interface{})
+	require.True(t, ok, "body is %T", body["body"])
+	require.Equal(t, "doc", doc["type"])
+	require.Contains(t, fmt.Sprint(doc["content"]), "Still firing.")
+}
+
+func TestSearchSummaryIgnoresCount(t *testing.T) {
+	var jql string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		jql = req.URL.Query().Get("jql")
+		_, _ = w.Write([]byte(`{"total": 2, "issues": [{"key": "XY-1", "fields": {"summary": "Down on web"}},` +
+			`{"key": "XY-2", "fields": {"summary": "Down (3 alerts)"}}]}`))
+	}))
+	defer srv.Close()
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	r, err := NewReceiver(&config.ReceiverConfig{
+		Name:                  "test",
+		APIURL:                srv.URL,
+		Summary:               `{{ .CommonLabels.alertname }}`,
+		SummaryCountThreshold: 1,
+	}, tmpl)
+	require.NoError(t, err)
+	data := &alertmanager.Data{CommonLabels: alertmanager.KV{"alertname": "Down"}}
+	for i := 0; i < 5; i++ {
+		data.Alerts = append(data.Alerts, alertmanager.Alert{Status: alertmanager.AlertFiring})
+	}
+
+	issue, _, err := r.searchSummary("XY", data, logger)
+	require.NoError(t, err)
+	require.NotNil(t, issue)
+	require.Equal(t, "XY-2", issue.Key)
+	require.NotContains(t, jql, "alerts")
+
+	// A summary shortened to fit a longer count still matches.
+	base := strings.Repeat("x", maxSummaryLength)
+	require.True(t, r.sameSummary(base[:maxSummaryLength-len(" (12 alerts)")]+" (12 alerts)", base[:maxSummaryLength-len(" (5 alerts)")]))
+	require.False(t, r.sameSummary("Down (3 alerts) again", "Down"))
+}
+
+func TestTemplateErrorFallback(t *testing.T) {
+	fake := &fakeJira{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	r, err := NewReceiver(&config.ReceiverConfig{
+		Name:                  "fallback",
+		APIURL:                srv.URL,
+		Project:               "XY",
+		IssueType:             "Task",
+		Summary:               `{{ .CommonLabels.alertname }}`,
+		Description:           `{{ .NoSuchField }}`,
+		MaxDescriptionChars:   200,
+		TemplateErrorFallback: true,
+	}, tmpl)
+	require.NoError(t, err)
+	data := &alertmanager.Data{Status: alertmanager.AlertFiring, GroupLabels: alertmanager.KV{"alertname": "Down"}, CommonLabels: alertmanager.KV{"alertname": "Down"}}
+	for i := 0; i < 20; i++ {
+		data.Alerts = append(data.Alerts, alertmanager.Alert{Status: alertmanager.AlertFiring, Labels: alertmanager.KV{"instance": fmt.Sprint(i)}})
+	}
+
+	key, err := r.dedupKey(data, logger)
+	require.NoError(t, err)
+	_, err = r.Notify(data, logger)
+	require.NoError(t, err)
+	require.Equal(t, "XY-1", r.IssueKey())
+	require.Len(t, fake.created, 1)
+	fields := fake.created[0]
+	require.Equal(t, "[FIRING] JIRAlert template error: Down", fields["summary"])
+	require.Contains(t, fields["labels"], fallbackLabel)
+	require.Contains(t, fields["labels"], key)
+	description := fields["description"].(string)
+	require.Equal(t, 200, utf8.RuneCountInString(description))
+	require.True(t, strings.HasSuffix(description, "[...] Description truncated."), description)
+}
+
+func TestScheduleResolveConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	searches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		searches++
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"issues": []}`))
+	}))
+	defer srv.Close()
+	ConfigureConcurrency(0, map[string]int{srv.URL: 1})
+	defer ConfigureConcurrency(0, nil)
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	timeout := config.Duration(20 * time.Millisecond)
+	r, err := NewReceiver(&config.ReceiverConfig{Name: "resolve", APIURL: srv.URL, Timeout: &timeout}, tmpl)
+	require.NoError(t, err)
+	pending := func() bool {
+		pendingResolves.Lock()
+		defer pendingResolves.Unlock()
+		_, ok := pendingResolves.timers["resolve|key"]
+		return ok
+	}
+
+	// With the only slot taken, the delayed resolve gives up without contacting JIRA.
+	release, err := acquireSlot(context.Background(), srv.URL)
+	require.NoError(t, err)
+	r.scheduleResolve("XY", "key", "Done", &alertmanager.Data{}, time.Millisecond, logger)
+	require.Eventually(t, func() bool { return !pending() }, time.Second, time.Millisecond)
+	release()
+	mu.Lock()
+	require.Equal(t, 0, searches)
+	mu.Unlock()
+
+	r.scheduleResolve("XY", "key", "Done", &alertmanager.Data{}, time.Millisecond, logger)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return searches == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestUpdateLabelsMaxLabels(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, http.MethodPut, req.Method)
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	r, err := NewReceiver(&config.ReceiverConfig{
+		Name:         "test",
+		APIURL:       srv.URL,
+		Labels:       []string{`{{ "a,b,c" }}`, "static"},
+		MaxLabels:    3,
+		UpdateLabels: true,
+	}, tmpl)
+	require.NoError(t, err)
+
+	issue := &jira.Issue{Key: "XY-1", Fields: &jira.IssueFields{Labels: []string{"ALERT{}", "a", "manual"}}}
+	_, err = r.updateLabels(issue, "ALERT{}", &alertmanager.Data{}, logger)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"labels": []interface{}{map[string]interface{}{"add": "static"}}}, body["update"])
+}
+
+func TestResolveIDs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "/rest/api/2/project/XY", req.URL.Path)
+		_, _ = w.Write([]byte(`{"key": "XY", "components": [{"id": "10", "name": "Operations"}], "versions": [{"id": "20", "name": "1.2"}]}`))
+	}))
+	defer srv.Close()
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	r, err := NewReceiver(&config.ReceiverConfig{Name: "test", APIURL: srv.URL, ResolveIDs: true}, tmpl)
+	require.NoError(t, err)
+
+	issue := &jira.Issue{Fields: &jira.IssueFields{
+		Project:    jira.Project{Key: "XY"},
+		Components: []*jira.Component{{Name: "Operations"}},
+		Unknowns:   map[string]interface{}{"fixVersions": []interface{}{map[string]interface{}{"name": "1.2"}, map[string]interface{}{"id": "30"}}},
+	}}
+	_, err = r.resolveIDs(issue, logger)
+	require.NoError(t, err)
+	require.Equal(t, &jira.Component{ID: "10"}, issue.Fields.Components[0])
+	require.Equal(t, []interface{}{map[string]interface{}{"id": "20"}, map[string]interface{}{"id": "30"}}, issue.Fields.Unknowns["fixVersions"])
+
+	issue.Fields.Unknowns["fixVersions"] = []interface{}{map[string]interface{}{"name": "9.9"}}
+	_, err = r.resolveIDs(issue, logger)
+	require.EqualError(t, err, `version "9.9" does not exist in project XY`)
+}
+
+func TestCheckIssueTypeTransient(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	r, err := NewReceiver(&config.ReceiverConfig{Name: "test", APIURL: srv.URL}, tmpl)
+	require.NoError(t, err)
+	issue := &jira.Issue{Fields: &jira.IssueFields{Project: jira.Project{Key: "XY"}, Type: jira.IssueType{Name: "Task"}}}
+
+	retry, err := r.checkIssueType(issue, logger)
+	require.NoError(t, err)
+	require.False(t, retry)
+
+	for _, status = range []int{http.StatusForbidden, http.StatusNotFound} {
+		_, err = r.checkIssueType(issue, logger)
+		require.NoError(t, err, "status %d", status)
+	}
+	status = http.StatusBadRequest
+	_, err = r.checkIssueType(issue, logger)
+	require.Error(t, err)
+}
+
+func TestNotifyProjectForbidden(t *testing.T) {
+	fake := &fakeJira{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.Contains(req.URL.Path, "/project/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fake.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	r, err := NewReceiver(&config.ReceiverConfig{
+		Name:      "forbidden",
+		APIURL:    srv.URL,
+		Project:   "XY",
+		IssueType: "Task",
+		Summary:   `{{ .CommonLabels.alertname }}`,
+	}, tmpl)
+	require.NoError(t, err)
+	data := &alertmanager.Data{Status: alertmanager.AlertFiring, GroupLabels: alertmanager.KV{"alertname": "Down"}, CommonLabels: alertmanager.KV{"alertname": "Down"}}
+
+	_, err = r.Notify(data, logger)
+	require.NoError(t, err)
+	require.Equal(t, "XY-1", r.IssueKey())
+	require.Len(t, fake.created, 1)
+}
+
+func TestReceiverLabel(t *testing.T) {
+	r := &Receiver{conf: &config.ReceiverConfig{Name: "jira ops", ReceiverLabelKey: "receiver"}}
+	require.Equal(t, "", r.receiverLabel())
+	r.conf.TagReceiver = true
+	require.Equal(t, "receiver:jira_ops", r.receiverLabel())
+}
+
+func TestScheduleResolveTimeout(t *testing.T) {
+	var mu sync.Mutex
+	searches := 0
+	canceled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/search") {
+			mu.Lock()
+			searches++
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{"issues": [{"key": "XY-1", "fields": {"status": {"statusCategory": {"key": "new"}}}}]}`))
+			return
+		}
+		// JIRA hangs on the transition.
+		select {
+		case <-req.Context().Done():
+			close(canceled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	timeout := config.Duration(50 * time.Millisecond)
+	r, err := NewReceiver(&config.ReceiverConfig{Name: "resolve-timeout", APIURL: srv.URL, Timeout: &timeout}, tmpl)
+	require.NoError(t, err)
+
+	r.scheduleResolve("XY", "key", "Done", &alertmanager.Data{}, time.Millisecond, logger)
+	select {
+	case <-canceled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("delayed transition not bounded by the receiver's timeout")
+	}
+	// The group's lock is released.
+	unlock := groupLocks.Lock("resolve-timeout|key")
+	unlock()
+
+	// Another replica handling the group means no search.
+	ReplicaLock = busyLocker{}
+	defer func() { ReplicaLock = noopLocker{} }()
+	r.scheduleResolve("XY", "key", "Done", &alertmanager.Data{}, time.Millisecond, logger)
+	require.Eventually(t, func() bool {
+		pendingResolves.Lock()
+		defer pendingResolves.Unlock()
+		_, ok := pendingResolves.timers["resolve-timeout|key"]
+		return !ok
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	require.Equal(t, 1, searches)
+	mu.Unlock()
+}
+
+func TestReopenExactName(t *testing.T) {
+	var done []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "/rest/api/2/issue/XY-1/transitions", req.URL.Path)
+		if req.Method == http.MethodPost {
+			var body struct {
+				Transition struct{ ID string } `json:"transition"`
+			}
+			require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+			done = append(done, body.Transition.ID)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_, _ = w.Write([]byte(`{"transitions": [{"id": "1", "name": "reopen"}, {"id": "2", "name": "Reopen"}]}`))
+	}))
+	defer srv.Close()
+
+	logger := log.NewNopLogger()
+	tmpl, err := template.LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	r, err := NewReceiver(&config.ReceiverConfig{Name: "test", APIURL: srv.URL, ReopenState: "Reopen"}, tmpl)
+	require.NoError(t, err)
+
+	_, err = r.reopen("XY-1", logger)
+	require.NoError(t, err)
+	require.Equal(t, []string{"2"}, done)
+
+	// Neither IDs nor other cases match reopen_state, unlike post_create_transition.
+	for _, state := range []string{"1", "REOPEN"} {
+		r.conf.ReopenState = state
+		_, err = r.reopen("XY-1", logger)
+		require.Error(t, err, state)
+	}
+	_, err = r.transition("XY-1", "REOPEN", false, logger)
+	require.NoError(t, err)
+	require.Equal(t, []string{"2", "1"}, done)
+}
@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// onCallCache holds the assignees looked up from on-call endpoints, by receiver and rendered URL.
+var onCallCache = struct {
+	sync.Mutex
+	entries map[string]onCallEntry
+}{entries: map[string]onCallEntry{}}
+
+type onCallEntry struct {
+	assignee string
+	expires  time.Time
+}
+
+// assign sets the assignee of the issue, as looked up from the receiver's on-call endpoint or, if that fails or
+// returns no one, rendered from its assignee template. An empty result leaves the issue to JIRA's default assignee.
+func (r *Receiver) assign(issue *jira.Issue, data *alertmanager.Data, logger log.Logger) error {
+	assignee := ""
+	if r.conf.OnCall != nil {
+		var err error
+		if assignee, err = r.lookupOnCall(data, logger); err != nil {
+			level.Warn(logger).Log("msg", "on-call lookup failed, falling back to the static assignee", "err", err)
+			onCallErrorsTotal.WithLabelValues(r.conf.Name).Inc()
+		}
+	}
+	if assignee == "" && r.conf.Assignee != "" {
+		assignee = strings.TrimSpace(r.tmpl.Execute(r.conf.Assignee, data, logger))
+		if err := r.tmpl.Err(); err != nil {
+			return &NotifyError{ErrorValidation, err}
+		}
+	}
+	if assignee == "" {
+		return nil
+	}
+	if r.conf.APIVersion == "3" {
+		// API v3 identifies users by account ID only.
+		issue.Fields.Assignee = &jira.User{AccountID: assignee}
+	} else {
+		issue.Fields.Assignee = &jira.User{Name: assignee}
+	}
+	return nil
+}
+
+// lookupOnCall returns the assignee the receiver's on-call endpoint currently returns for the alert group, reusing
+// the result of an earlier lookup of the same URL within the cache TTL.
+func (r *Receiver) lookupOnCall(data *alertmanager.Data, logger log.Logger) (string, error) {
+	oc := r.conf.OnCall
+	u := r.tmpl.Execute(oc.URL, data, logger)
+	if err := r.tmpl.Err(); err != nil {
+		return "", err
+	}
+	key := r.conf.Name + "|" + u
+	now := time.Now()
+	onCallCache.Lock()
+	e, ok := onCallCache.entries[key]
+	onCallCache.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.assignee, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range oc.Headers {
+		req.Header.Set(name, string(value))
+	}
+	level.Debug(logger).Log("msg", "on-call lookup", "url", u)
+	client := http.Client{Timeout: time.Duration(*oc.Timeout)}
+	resp, err := client.Do(req)
+	if err != nil {
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return "", fmt.Errorf("on-call lookup %s failed: %s", u, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("on-call lookup %s returned status %s", u, resp.Status)
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding on-call lookup response: %s", err)
+	}
+	assignee, ok := body[oc.Field].(string)
+	if !ok && body[oc.Field] != nil {
+		return "", fmt.Errorf("on-call lookup %s returned a non-string %q", u, oc.Field)
+	}
+
+	onCallCache.Lock()
+	defer onCallCache.Unlock()
+	for k, e := range onCallCache.entries {
+		if now.After(e.expires) {
+			delete(onCallCache.entries, k)
+		}
+	}
+	onCallCache.entries[key] = onCallEntry{assignee: assignee, expires: now.Add(time.Duration(*oc.CacheTTL))}
+	return assignee, nil
+}
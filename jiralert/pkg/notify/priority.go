@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// escalationPriority returns the priority of the highest EscalatePriority threshold the number of firing alerts
+// reaches, or "" if none.
+func (r *Receiver) escalationPriority(data *alertmanager.Data) string {
+	count := len(data.Alerts.Firing())
+	priority, best := "", 0
+	for threshold, p := range r.conf.EscalatePriority {
+		if count >= threshold && threshold > best {
+			priority, best = p, threshold
+		}
+	}
+	return priority
+}
+
+// priorityRank returns the position of the named priority in JIRA's priority scheme, highest first, or -1 if there
+// is no such priority.
+func priorityRank(priorities []jira.Priority, name string) int {
+	for i, p := range priorities {
+		if strings.EqualFold(p.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// escalatePriority raises the priority of the unresolved issue to the one its alert group's size calls for, see
+// ReceiverConfig.EscalatePriority. Issues already at that priority or above, e.g. raised by hand, are left alone.
+func (r *Receiver) escalatePriority(issue *jira.Issue, data *alertmanager.Data, logger log.Logger) (bool, error) {
+	target := r.escalationPriority(data)
+	current := ""
+	if issue.Fields.Priority != nil {
+		current = issue.Fields.Priority.Name
+	}
+	if target == "" || strings.EqualFold(current, target) {
+		return false, nil
+	}
+
+	priorities, resp, err := r.client.Priority.GetList()
+	if err != nil {
+		return r.handleJiraError("Priority.GetList", resp, err, logger)
+	}
+	rank := priorityRank(priorities, target)
+	if rank < 0 {
+		return false, &NotifyError{ErrorValidation, fmt.Errorf("unknown escalate_priority %q", target)}
+	}
+	if c := priorityRank(priorities, current); c >= 0 && c <= rank {
+		level.Debug(logger).Log("msg", "issue priority already at or above escalation priority", "key", issue.Key, "priority", current, "escalate_priority", target)
+		return false, nil
+	}
+
+	level.Info(logger).Log("msg", "escalating issue priority", "key", issue.Key, "from", current, "to", target, "firing", len(data.Alerts.Firing()))
+	resp, err = r.client.Issue.UpdateIssue(issue.Key, map[string]interface{}{"fields": map[string]interface{}{"priority": map[string]string{"name": target}}})
+	if err != nil {
+		return r.handleJiraError("Issue.UpdateIssue", resp, err, logger)
+	}
+	r.audit(auditUpdate, data, issue.Key, logger)
+	return false, nil
+}
@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// projectCacheTTL is how long fetched project metadata is reused before being fetched again, so that components and
+// issue types added in JIRA are picked up without a restart.
+const projectCacheTTL = 10 * time.Minute
+
+// projectTypeServiceDesk is the project type key of JIRA Service Management projects.
+const projectTypeServiceDesk = "service_desk"
+
+// projectInfo is a JIRA project, including the project type go-jira doesn't decode.
+type projectInfo struct {
+	jira.Project
+	ProjectTypeKey string `json:"projectTypeKey"`
+}
+
+type projectCacheEntry struct {
+	project *projectInfo
+	fetched time.Time
+}
+
+// projectCache holds project metadata shared by all receivers, keyed by API URL and project key.
+var projectCache = struct {
+	sync.Mutex
+	entries map[string]projectCacheEntry
+}{entries: map[string]projectCacheEntry{}}
+
+// project returns the named JIRA project, from the cache if fresh enough.
+func (r *Receiver) project(key string, logger log.Logger) (*projectInfo, bool, error) {
+	cacheKey := r.conf.APIURL + "|" + key
+
+	projectCache.Lock()
+	entry, ok := projectCache.entries[cacheKey]
+	projectCache.Unlock()
+	if ok && time.Since(entry.fetched) < projectCacheTTL {
+		return entry.project, false, nil
+	}
+
+	level.Debug(logger).Log("msg", "fetching project", "project", key)
+	req, err := r.client.NewRequest("GET", "rest/api/2/project/"+url.PathEscape(key), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	project := &projectInfo{}
+	resp, err := r.client.Do(req, project)
+	if err != nil {
+		retry, err := r.handleJiraError("Project.Get", resp, err, logger)
+		return nil, retry, err
+	}
+
+	projectCache.Lock()
+	projectCache.entries[cacheKey] = projectCacheEntry{project: project, fetched: time.Now()}
+	projectCache.Unlock()
+	return project, false, nil
+}
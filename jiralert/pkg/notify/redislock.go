@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// releaseScript deletes the lock only if it still holds our token, i.e. it didn't expire and get taken over meanwhile.
+const releaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+// redisLocker is a Locker backed by Redis keys set with NX and an expiry, so a crashed replica can't hold a lock
+// forever.
+type redisLocker struct {
+	address  string
+	password string
+	ttl      time.Duration
+	timeout  time.Duration
+}
+
+// NewRedisLocker returns a Locker storing locks in the Redis server at address. Locks expire after ttl, which should
+// comfortably exceed the time a notification takes.
+func NewRedisLocker(address, password string, ttl time.Duration) Locker {
+	return &redisLocker{address: address, password: password, ttl: ttl, timeout: 5 * time.Second}
+}
+
+// TryLock implements the Locker interface.
+func (l *redisLocker) TryLock(key string) (func(), bool, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, false, err
+	}
+	key = "jiralert:lock:" + key
+
+	reply, err := l.do("SET", key, token, "NX", "PX", strconv.FormatInt(int64(l.ttl/time.Millisecond), 10))
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	// Release failures are harmless, the lock expires eventually.
+	return func() { _, _ = l.do("EVAL", releaseScript, "1", key, token) }, true, nil
+}
+
+// do sends a command over a new connection and returns the reply, nil for a null reply.
+func (l *redisLocker) do(args ...string) (*string, error) {
+	conn, err := net.DialTimeout("tcp", l.address, l.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(l.timeout))
+
+	rd := bufio.NewReader(conn)
+	if l.password != "" {
+		if _, err := roundTrip(conn, rd, "AUTH", l.password); err != nil {
+			return nil, err
+		}
+	}
+	return roundTrip(conn, rd, args...)
+}
+
+// roundTrip writes a command in the Redis protocol (RESP) and reads a simple string, error, integer or bulk string
+// reply.
+func roundTrip(conn net.Conn, rd *bufio.Reader, args ...string) (*string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := conn.Write([]byte(b.String())); err != nil {
+		return nil, err
+	}
+
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty redis reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		v := line[1:]
+		return &v, nil
+	case '-':
+		return nil, fmt.Errorf("redis %s failed: %s", args[0], line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		v := string(buf[:n])
+		return &v, nil
+	default:
+		return nil, fmt.Errorf("unexpected redis reply %q", line)
+	}
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// pendingResolves holds the timers of resolutions delayed by ReceiverConfig.AutoResolveDelay, by receiver and dedup
+// key. They only live in memory: a resolution pending when JIRAlert exits is not performed.
+var pendingResolves = struct {
+	sync.Mutex
+	timers map[string]*time.Timer
+}{timers: map[string]*time.Timer{}}
+
+// resolveDelay returns how much longer to wait until the alert group has been resolved for delay, going by the end of
+// its most recently resolved alert. It returns 0 or less if it has been resolved long enough.
+func resolveDelay(data *alertmanager.Data, delay time.Duration, now time.Time) time.Duration {
+	var last time.Time
+	for _, a := range data.Alerts {
+		if a.EndsAt.After(last) {
+			last = a.EndsAt
+		}
+	}
+	if last.IsZero() {
+		last = now
+	}
+	return last.Add(delay).Sub(now)
+}
+
+// scheduleResolve performs the resolved status transition of the alert group's issue after wait, unless the group
+// fires again in the meantime, see cancelResolve. The issue is searched again then, as it may have been resolved or
+// replaced by hand.
+func (r *Receiver) scheduleResolve(project, issueLabel, transition string, data *alertmanager.Data, wait time.Duration, logger log.Logger) {
+	key := r.conf.Name + "|" + issueLabel
+	pendingResolves.Lock()
+	defer pendingResolves.Unlock()
+	if t, ok := pendingResolves.timers[key]; ok {
+		t.Stop()
+	}
+	var t *time.Timer
+	t = time.AfterFunc(wait, func() {
+		// t is set while holding the lock.
+		pendingResolves.Lock()
+		t := t
+		pendingResolves.Unlock()
+
+		// The Notify call of r is long over, the resolve gets a receiver and timeout of its own.
+		dr, err := r.delayedResolver(data)
+		if err != nil {
+			forgetResolve(key, t)
+			level.Error(logger).Log("msg", "failed to resolve issue after auto_resolve_delay", "label", issueLabel, "err", err)
+			return
+		}
+		ctx := context.Background()
+		if timeout := dr.timeout(); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+			dr.ctx = ctx
+		}
+		// Like Notify, wait for the JIRA instance's jira_concurrency before the group's lock.
+		release, err := acquireSlot(ctx, dr.conf.APIURL)
+		if err != nil {
+			forgetResolve(key, t)
+			level.Error(logger).Log("msg", "timed out waiting for jira_concurrency to resolve issue after auto_resolve_delay", "label", issueLabel, "err", err)
+			return
+		}
+		defer release()
+
+		unlock, ok := dr.lockGroup(issueLabel, logger)
+		defer unlock()
+		if !forgetResolve(key, t) {
+			return
+		}
+		if !ok {
+			level.Info(logger).Log("msg", "alert group is being handled by another replica, not resolving its issue", "label", issueLabel)
+			return
+		}
+
+		issue, _, err := dr.search(project, issueLabel, logger)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to search issue for delayed resolve", "label", issueLabel, "err", err)
+			return
+		}
+		if issue == nil || issue.Fields.Status.StatusCategory.Key == "done" {
+			level.Debug(logger).Log("msg", "alert group stayed resolved, but there is no unresolved issue to transition", "label", issueLabel)
+			return
+		}
+		if _, err := dr.statusTransition(issue.Key, alertmanager.AlertResolved, transition, data, logger); err != nil {
+			level.Error(logger).Log("msg", "failed to resolve issue after auto_resolve_delay", "key", issue.Key, "err", err)
+		}
+	})
+	pendingResolves.timers[key] = t
+}
+
+// delayedResolver returns a new receiver like r for a delayed resolve of the alert group, impersonating the user
+// rendered from data if configured.
+func (r *Receiver) delayedResolver(data *alertmanager.Data) (*Receiver, error) {
+	dr, err := NewReceiver(r.conf, r.tmpl)
+	if err != nil {
+		return nil, err
+	}
+	if r.conf.Impersonate != "" {
+		dr.impersonate = dr.tmpl.Execute(r.conf.Impersonate, data, log.NewNopLogger())
+		if err := dr.tmpl.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return dr, nil
+}
+
+// forgetResolve removes the pending resolution timer t of key, returning whether it was still the pending one.
+func forgetResolve(key string, t *time.Timer) bool {
+	pendingResolves.Lock()
+	defer pendingResolves.Unlock()
+	if pendingResolves.timers[key] != t {
+		return false
+	}
+	delete(pendingResolves.timers, key)
+	return true
+}
+
+// cancelResolve cancels the pending resolution of the alert group's issue, if any, returning whether there was one.
+// The caller must hold the group's lock.
+func (r *Receiver) cancelResolve(issueLabel string) bool {
+	key := r.conf.Name + "|" + issueLabel
+	pendingResolves.Lock()
+	defer pendingResolves.Unlock()
+	t, ok := pendingResolves.timers[key]
+	if ok {
+		t.Stop()
+		delete(pendingResolves.timers, key)
+	}
+	return ok
+}
@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// maxProjectLabels bounds the number of distinct project label values, since projects may be templated.
+	maxProjectLabels = 100
+	// otherProject is the project label value used beyond maxProjectLabels or for values not looking like a key.
+	otherProject = "<other>"
+)
+
+// projectKeyRE matches valid JIRA project keys.
+var projectKeyRE = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+var (
+	authErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jiralert_jira_auth_errors_total",
+			Help: "JIRA requests rejected with 401 Unauthorized or 403 Forbidden, by receiver.",
+		},
+		[]string{"receiver"},
+	)
+	issuesCreatedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jiralert_issues_created_total",
+			Help: "Issues created, by receiver and project.",
+		},
+		[]string{"receiver", "project"},
+	)
+	issuesReopenedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jiralert_issues_reopened_total",
+			Help: "Issues reopened, by receiver and project.",
+		},
+		[]string{"receiver", "project"},
+	)
+	rateLimitLimit = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "jiralert_jira_ratelimit_limit",
+			Help: "Request rate limit reported by JIRA (X-RateLimit-Limit) in the last response, by receiver.",
+		},
+		[]string{"receiver"},
+	)
+	rateLimitRemaining = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "jiralert_jira_ratelimit_remaining",
+			Help: "Requests remaining before JIRA throttles (X-RateLimit-Remaining) as of the last response, by receiver.",
+		},
+		[]string{"receiver"},
+	)
+	outsideActiveTimeTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jiralert_outside_active_time_total",
+			Help: "Issues not created because the notification arrived outside the active time intervals, by receiver.",
+		},
+		[]string{"receiver"},
+	)
+	droppedFieldsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jiralert_dropped_fields_total",
+			Help: "Fields left out of created issues after JIRA rejected them, with drop_invalid_fields, by receiver.",
+		},
+		[]string{"receiver"},
+	)
+	jiraInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "jiralert_jira_in_flight",
+			Help: "Notifications being handled, not counting those waiting for jira_concurrency, by JIRA instance.",
+		},
+		[]string{"api_url"},
+	)
+	dedupCacheEntries = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "jiralert_dedup_cache_entries",
+			Help: "Alert groups remembered as recently created, for dedup_grace.",
+		},
+	)
+	onCallErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jiralert_oncall_lookup_errors_total",
+			Help: "Failed on-call lookups, in which case the static assignee is used, by receiver.",
+		},
+		[]string{"receiver"},
+	)
+	fallbackIssuesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jiralert_fallback_issues_total",
+			Help: "Issues created without templates after the receiver's templates failed to render, by receiver.",
+		},
+		[]string{"receiver"},
+	)
+	auditErrorsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "jiralert_audit_errors_total",
+			Help: "Audit records that failed to be written to --audit-log-file.",
+		},
+	)
+	postCreateErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jiralert_post_create_errors_total",
+			Help: "Steps that failed after an issue was created (wait_for_issue, transition, attachment, attach_csv, attach_image, remote_links, notify_webhook), by receiver and step.",
+		},
+		[]string{"receiver", "step"},
+	)
+
+	projectLabels = struct {
+		sync.Mutex
+		seen map[string]bool
+	}{seen: map[string]bool{}}
+)
+
+// projectLabel returns the value to use for the project label of metrics.
+func projectLabel(project string) string {
+	if !projectKeyRE.MatchString(project) {
+		return otherProject
+	}
+	projectLabels.Lock()
+	defer projectLabels.Unlock()
+	if !projectLabels.seen[project] {
+		if len(projectLabels.seen) >= maxProjectLabels {
+			return otherProject
+		}
+		projectLabels.seen[project] = true
+	}
+	return project
+}
+
+func init() {
+	prometheus.MustRegister(authErrorsTotal)
+	prometheus.MustRegister(issuesCreatedTotal)
+	prometheus.MustRegister(issuesReopenedTotal)
+	prometheus.MustRegister(postCreateErrorsTotal)
+	prometheus.MustRegister(outsideActiveTimeTotal)
+	prometheus.MustRegister(rateLimitLimit)
+	prometheus.MustRegister(rateLimitRemaining)
+	prometheus.MustRegister(dedupCacheEntries)
+	prometheus.MustRegister(jiraInFlight)
+	prometheus.MustRegister(droppedFieldsTotal)
+	prometheus.MustRegister(auditErrorsTotal)
+	prometheus.MustRegister(onCallErrorsTotal)
+	prometheus.MustRegister(fallbackIssuesTotal)
+}
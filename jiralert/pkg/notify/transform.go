@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// transform posts the issue as JSON to the receiver's transform endpoint and replaces it with the issue returned. When
+// the transform fails, the issue is left unchanged and an error returned, unless the receiver is configured to fail
+// open, in which case the failure is only logged.
+func (r *Receiver) transform(issue *jira.Issue, logger log.Logger) error {
+	err := r.doTransform(issue, logger)
+	if err != nil && r.conf.Transform.FailOpen {
+		level.Warn(logger).Log("msg", "issue transform failed, submitting issue unchanged", "url", r.conf.Transform.URL, "err", err)
+		return nil
+	}
+	return err
+}
+
+func (r *Receiver) doTransform(issue *jira.Issue, logger log.Logger) error {
+	body, err := json.Marshal(issue)
+	if err != nil {
+		return err
+	}
+
+	level.Debug(logger).Log("msg", "transform", "url", r.conf.Transform.URL)
+	client := http.Client{Timeout: time.Duration(*r.conf.Transform.Timeout)}
+	resp, err := client.Post(r.conf.Transform.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("issue transform failed: %s", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("issue transform %s returned status %s", r.conf.Transform.URL, resp.Status)
+	}
+
+	transformed := jira.Issue{}
+	if err := json.NewDecoder(resp.Body).Decode(&transformed); err != nil {
+		return fmt.Errorf("decoding issue transform response: %s", err)
+	}
+	if transformed.Fields == nil {
+		return fmt.Errorf("issue transform %s returned an issue without fields", r.conf.Transform.URL)
+	}
+	*issue = transformed
+
+	level.Debug(logger).Log("msg", "  done")
+	return nil
+}
@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// apiVersionTransport rewrites the REST API v2 paths used by go-jira to the configured API version.
+type apiVersionTransport struct {
+	version string
+	next    http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *apiVersionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.Contains(req.URL.Path, "/rest/api/2/") {
+		// Don't modify the caller's request, as required by the http.RoundTripper contract.
+		req = req.Clone(req.Context())
+		req.URL.Path = strings.Replace(req.URL.Path, "/rest/api/2/", "/rest/api/"+t.version+"/", 1)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// contextTransport sends all requests with the context of the receiver's ongoing Notify call, if any, so they are
+// canceled once the receiver's timeout expires.
+type contextTransport struct {
+	receiver *Receiver
+	next     http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if ctx := t.receiver.ctx; ctx != nil {
+		req = req.WithContext(ctx)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// impersonateTransport sets the header impersonating the user of the receiver's ongoing Notify call, if any.
+type impersonateTransport struct {
+	receiver *Receiver
+	header   string
+	next     http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *impersonateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if user := t.receiver.impersonate; user != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(t.header, user)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// headerTransport sets additional headers on all requests.
+type headerTransport struct {
+	headers map[string]string
+	next    http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// rateLimitTransport records the rate limit headers JIRA Cloud sends with responses. JIRA Server doesn't send them,
+// in which case the gauges are left unset.
+type rateLimitTransport struct {
+	receiver string
+	next     http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if v, err := strconv.ParseFloat(resp.Header.Get("X-RateLimit-Limit"), 64); err == nil {
+		rateLimitLimit.WithLabelValues(t.receiver).Set(v)
+	}
+	if v, err := strconv.ParseFloat(resp.Header.Get("X-RateLimit-Remaining"), 64); err == nil {
+		rateLimitRemaining.WithLabelValues(t.receiver).Set(v)
+	}
+	return resp, err
+}
+
+// userAgentTransport sets the User-Agent header of all requests.
+type userAgentTransport struct {
+	userAgent string
+	next      http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// firingOnly returns the alert group reduced to its firing alerts, with the common labels and annotations of just
+// those, see ReceiverConfig.StripResolvedOnUpdate. Alertmanager computes the common ones over all alerts of the group,
+// resolved ones included. A group without firing alerts is returned unchanged.
+func firingOnly(data *alertmanager.Data) *alertmanager.Data {
+	firing := data.Alerts.Firing()
+	if len(firing) == 0 {
+		return data
+	}
+	stripped := *data
+	stripped.Alerts = firing
+	stripped.CommonLabels = commonKV(firing, func(a alertmanager.Alert) alertmanager.KV { return a.Labels })
+	stripped.CommonAnnotations = commonKV(firing, func(a alertmanager.Alert) alertmanager.KV { return a.Annotations })
+	return &stripped
+}
+
+// commonKV returns the pairs that all alerts have in common, out of the ones kv returns for each.
+func commonKV(alerts []alertmanager.Alert, kv func(alertmanager.Alert) alertmanager.KV) alertmanager.KV {
+	common := alertmanager.KV{}
+	for name, value := range kv(alerts[0]) {
+		common[name] = value
+	}
+	for _, a := range alerts[1:] {
+		other := kv(a)
+		for name, value := range common {
+			if v, ok := other[name]; !ok || v != value {
+				delete(common, name)
+			}
+		}
+	}
+	return common
+}
+
+// updateFields brings the fields of the unresolved issue in line with the alert group, rendering them anew. Fields
+// that now render empty are cleared.
+func (r *Receiver) updateFields(issue *jira.Issue, data *alertmanager.Data, logger log.Logger) (bool, error) {
+	fields, err := r.renderFields(data, logger)
+	if err != nil {
+		return false, err
+	}
+	if err := r.tmpl.Err(); err != nil {
+		return false, &NotifyError{ErrorValidation, err}
+	}
+
+	changed := map[string]interface{}{}
+	for key := range r.conf.Fields {
+		current := issue.Fields.Unknowns[key]
+		value, ok := fields[key]
+		if !ok {
+			if current != nil {
+				changed[key] = nil
+			}
+			continue
+		}
+		if !fieldContains(current, value) {
+			changed[key] = value
+		}
+	}
+	if len(changed) == 0 {
+		return false, nil
+	}
+
+	names := make([]string, 0, len(changed))
+	for key := range changed {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	level.Info(logger).Log("msg", "updating fields of unresolved issue", "key", issue.Key, "fields", strings.Join(names, " "))
+	resp, err := r.client.Issue.UpdateIssue(issue.Key, map[string]interface{}{"fields": changed})
+	if err != nil {
+		return r.handleJiraError("Issue.UpdateIssue", resp, err, logger)
+	}
+	r.audit(auditUpdate, data, issue.Key, logger)
+	return false, nil
+}
+
+// fieldContains reports whether the field value JIRA returned matches the rendered one. JIRA returns more than was
+// submitted, e.g. the ID and URL of a select option besides its value, so maps only need to contain the rendered
+// keys. Scalars are compared as text, as JIRA returns all numbers as float64.
+func fieldContains(current, rendered interface{}) bool {
+	switch want := rendered.(type) {
+	case map[string]interface{}:
+		have, ok := current.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range want {
+			if !fieldContains(have[key], value) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		have, ok := current.([]interface{})
+		if !ok || len(have) != len(want) {
+			return false
+		}
+		for i := range want {
+			if !fieldContains(have[i], want[i]) {
+				return false
+			}
+		}
+		return true
+	case nil:
+		return current == nil
+	case json.Number:
+		f, err := want.Float64()
+		return err == nil && fmt.Sprint(f) == fmt.Sprint(current)
+	default:
+		return current != nil && fmt.Sprint(want) == fmt.Sprint(current)
+	}
+}
+
+// updateUnresolved brings the unresolved issue of the alert group up to date, as configured.
+func (r *Receiver) updateUnresolved(issue *jira.Issue, issueLabel string, data *alertmanager.Data, logger log.Logger) (bool, error) {
+	if r.conf.AlertCountField != "" {
+		if retry, err := r.updateAlertCount(issue, data, logger); err != nil {
+			return retry, err
+		}
+	}
+	if len(r.conf.EscalatePriority) > 0 {
+		if retry, err := r.escalatePriority(issue, data, logger); err != nil {
+			return retry, err
+		}
+	}
+	if transition := r.conf.StatusTransitions[alertmanager.AlertFiring]; transition != "" && data.Status != alertmanager.AlertResolved {
+		if retry, err := r.statusTransition(issue.Key, alertmanager.AlertFiring, transition, data, logger); err != nil {
+			return retry, err
+		}
+	}
+	if r.conf.HeartbeatComment != "" && data.Status != alertmanager.AlertResolved {
+		if retry, err := r.heartbeat(issue.Key, data, time.Now(), logger); err != nil {
+			return retry, err
+		}
+	}
+	if r.conf.StripResolvedOnUpdate {
+		firing := firingOnly(data)
+		if retry, err := r.updateFields(issue, firing, logger); err != nil {
+			return retry, err
+		}
+		return r.updateLabels(issue, issueLabel, firing, logger)
+	}
+	if r.conf.UpdateLabels {
+		return r.updateLabels(issue, issueLabel, data, logger)
+	}
+	level.Debug(logger).Log("msg", "issue is unresolved, nothing to do", "key", issue.Key, "label", issueLabel)
+	return false, nil
+}
+
+// issueGone reports whether err means the issue no longer exists, e.g. as it was deleted after being searched, and
+// RecreateOnMissing is set.
+func (r *Receiver) issueGone(issueKey, issueLabel string, err error, logger log.Logger) bool {
+	if err == nil || !r.conf.RecreateOnMissing || !isNotFound(err) {
+		return false
+	}
+	level.Warn(logger).Log("msg", "issue no longer exists, it was probably deleted", "key", issueKey, "label", issueLabel, "err", err)
+	return true
+}
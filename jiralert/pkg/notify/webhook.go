@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// webhookData is what notify webhook payload templates are executed with.
+type webhookData struct {
+	*alertmanager.Data
+	IssueKey string
+	IssueURL string
+}
+
+// notifyWebhook posts the receiver's notify webhook payload for the newly created issue.
+func (r *Receiver) notifyWebhook(data *alertmanager.Data, issueKey string, logger log.Logger) error {
+	payload := r.tmpl.Execute(r.conf.NotifyWebhook.Payload, webhookData{
+		Data:     data,
+		IssueKey: issueKey,
+		IssueURL: strings.TrimSuffix(r.conf.APIURL, "/") + "/browse/" + issueKey,
+	}, logger)
+	if err := r.tmpl.Err(); err != nil {
+		return err
+	}
+	if !json.Valid([]byte(payload)) {
+		return fmt.Errorf("notify webhook payload is not valid JSON: %s", payload)
+	}
+
+	level.Debug(logger).Log("msg", "notify webhook", "key", issueKey)
+	client := http.Client{Timeout: time.Duration(*r.conf.NotifyWebhook.Timeout)}
+	resp, err := client.Post(string(r.conf.NotifyWebhook.URL), "application/json", strings.NewReader(payload))
+	if err != nil {
+		// Don't log the URL, it usually embeds a token.
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return fmt.Errorf("posting to notify webhook failed: %s", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("notify webhook returned status %s", resp.Status)
+	}
+
+	level.Debug(logger).Log("msg", "  done")
+	return nil
+}
@@ -0,0 +1,17 @@
+package template
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	templateErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jiralert_template_errors_total",
+			Help: "Template executions that failed or rendered \"<no value>\", by receiver and template.",
+		},
+		[]string{"receiver", "template"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(templateErrorsTotal)
+}
@@ -2,20 +2,43 @@ package template
 
 import (
 	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"net/url"
+	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
+	"time"
+
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
 )
 
 // Template wraps a text template and error, to make it easier to execute multiple templates and only check for errors
 // once at the end (assuming one is only interested in the first error, which is usually the case).
 type Template struct {
-	tmpl *template.Template
-	err  error
+	tmpl      *template.Template
+	receivers map[string]*template.Template
+	// Left delimiter of the receiver's templates, "{{" if empty.
+	leftDelim string
+	delims    map[string][2]string
+	// Name of the receiver the templates are executed for, if any.
+	receiver string
+	// Time zone localTime converts to, UTC if nil.
+	location *time.Location
+	err      error
 }
 
+// templateRefRE extracts the names of templates referenced by a template invocation.
+var templateRefRE = regexp.MustCompile(`{{-?\s*template\s+"([^"]+)"`)
+
 var funcs = template.FuncMap{
 	"toUpper": strings.ToUpper,
 	"toLower": strings.ToLower,
@@ -25,20 +48,179 @@ var funcs = template.FuncMap{
 	"join": func(sep string, s []string) string {
 		return strings.Join(s, sep)
 	},
+	// split is equal to strings.Split but inverts the argument order and trims whitespace from the parts, dropping
+	// empty ones.
+	"split": func(sep, s string) []string {
+		parts := []string{}
+		for _, p := range strings.Split(s, sep) {
+			if p = strings.TrimSpace(p); p != "" {
+				parts = append(parts, p)
+			}
+		}
+		return parts
+	},
+	// pathEscape escapes a value for use as a URL path segment, e.g.
+	// https://grafana.example.com/d/{{ .CommonLabels.dashboard | pathEscape }}. For query parameters, use the builtin
+	// urlquery, e.g. https://prometheus.example.com/graph?g0.expr={{ .CommonLabels.alertname | urlquery }}.
+	"pathEscape": url.PathEscape,
+	// base64 encodes a value as standard base64, e.g. {{ .CommonLabels.instance | base64 }}.
+	"base64": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
 	"reReplaceAll": func(pattern, repl, text string) string {
 		re := regexp.MustCompile(pattern)
 		return re.ReplaceAllString(text, repl)
 	},
+	"countBy": countBy,
+	// fingerprints returns the fingerprints of the given alerts.
+	"fingerprints": func(alerts alertmanager.Alerts) []string {
+		return alerts.Fingerprints()
+	},
+	// stableHash hashes the values of the named labels, e.g. {{ stableHash .CommonLabels "alertname" "cluster" }}, into
+	// an identifier that is the same on every notification for as long as these labels are.
+	"stableHash": stableHash,
+	// localTime converts a time to the receiver's time zone. Overridden per execution, see Template.Execute.
+	"localTime": func(t time.Time) time.Time {
+		return t.UTC()
+	},
+	// jqlEscape escapes a value for use inside a double-quoted JQL string.
+	"jqlEscape": JQLEscape,
+	// annotationOr, hasAnnotation, labelOr and hasLabel look up the common annotations and labels of the data the
+	// template is executed with. Overridden per execution, see Template.Execute.
+	"annotationOr":  func(key, def string) string { return def },
+	"hasAnnotation": func(key string) bool { return false },
+	"labelOr":       func(key, def string) string { return def },
+	"hasLabel":      func(key string) bool { return false },
+	// toJSON encodes a value as JSON, e.g. a string as a quoted JSON string.
+	"toJSON": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
 }
 
-// LoadTemplate reads and parses all templates defined in the given file and constructs a jiralert.Template.
-func LoadTemplate(path string, logger log.Logger) (*Template, error) {
+// stableHash returns the first 12 hex digits of the SHA-256 of the given labels and their values, sorted by name. A
+// missing label hashes like an empty one.
+func stableHash(kv alertmanager.KV, names ...string) string {
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%q=%q\n", name, kv[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// JQLEscape escapes a value for use inside a double-quoted JQL string.
+func JQLEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// countBy returns a summary of how many alerts carry each value of the given label, e.g. "3 critical, 5 warning".
+// Values are listed alphabetically so the output is stable; alerts without the label are not counted.
+func countBy(alerts alertmanager.Alerts, label string) string {
+	counts := map[string]int{}
+	for _, a := range alerts {
+		if v, ok := a.Labels[label]; ok {
+			counts[v]++
+		}
+	}
+	values := make([]string, 0, len(counts))
+	for v := range counts {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[v], v))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// defaultTemplates are the built-in "jira.summary" and "jira.description" templates, parsed before the template file.
+//
+//go:embed default.tmpl
+var defaultTemplates string
+
+// LoadTemplate reads and parses all templates defined in the given file and constructs a jiralert.Template. The file
+// is parsed on top of the built-in default templates, so it only needs to define the blocks it overrides. If path is
+// empty, only the defaults are loaded.
+//
+// receiverFiles optionally maps receiver names to additional template files. Each of them is parsed into a separate
+// copy of the shared templates, so its blocks are only visible to (and override shared blocks only for) that receiver.
+// receiverDelims optionally maps receiver names to the left and right delimiters their template file and templates
+// are parsed with, instead of "{{" and "}}".
+func LoadTemplate(path string, receiverFiles map[string]string, receiverDelims map[string][2]string, logger log.Logger) (*Template, error) {
 	level.Debug(logger).Log("msg", "loading templates", "path", path)
-	tmpl, err := template.New("").Option("missingkey=zero").Funcs(funcs).ParseFiles(path)
+	tmpl, err := template.New("").Option("missingkey=zero").Funcs(funcs).Parse(defaultTemplates)
 	if err != nil {
 		return nil, err
 	}
-	return &Template{tmpl: tmpl}, nil
+	if path != "" {
+		if tmpl, err = tmpl.ParseFiles(path); err != nil {
+			return nil, err
+		}
+	}
+
+	receivers := make(map[string]*template.Template, len(receiverFiles)+len(receiverDelims))
+	for name := range receiverDelims {
+		receivers[name] = nil
+	}
+	for name := range receiverFiles {
+		receivers[name] = nil
+	}
+	for name := range receivers {
+		rt, err := tmpl.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if d, ok := receiverDelims[name]; ok {
+			rt.Delims(d[0], d[1])
+		}
+		if file, ok := receiverFiles[name]; ok {
+			level.Debug(logger).Log("msg", "loading receiver templates", "receiver", name, "path", file)
+			if rt, err = rt.ParseFiles(file); err != nil {
+				return nil, fmt.Errorf("loading template_file of receiver %q: %s", name, err)
+			}
+		}
+		receivers[name] = rt
+	}
+	return &Template{tmpl: tmpl, receivers: receivers, delims: receiverDelims}, nil
+}
+
+// MissingTemplates returns the names of the templates referenced by any of texts that are not defined.
+func (t *Template) MissingTemplates(texts []string) []string {
+	var missing []string
+	seen := map[string]bool{}
+	for _, text := range texts {
+		for _, m := range t.refRE().FindAllStringSubmatch(text, -1) {
+			name := m[1]
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if t.tmpl.Lookup(name) == nil {
+				missing = append(missing, name)
+			}
+		}
+	}
+	return missing
+}
+
+// WithLocation returns a copy of t whose localTime template function converts times to the given location.
+func (t *Template) WithLocation(loc *time.Location) *Template {
+	c := *t
+	c.location = loc
+	return &c
+}
+
+// ForReceiver returns a Template for executing the named receiver's templates: the shared ones plus those from its
+// own template file, if any. The returned Template has no error recorded yet.
+func (t *Template) ForReceiver(name string) *Template {
+	if rt, ok := t.receivers[name]; ok {
+		return &Template{tmpl: rt, receiver: name, leftDelim: t.delims[name][0]}
+	}
+	return &Template{tmpl: t.tmpl, receiver: name}
 }
 
 func (t *Template) Err() error {
@@ -48,9 +230,9 @@ func (t *Template) Err() error {
 // Execute parses the provided text (or returns it unchanged if not a Go template), associates it with the templates
 // defined in t.tmpl (so they may be referenced and used) and applies the resulting template to the specified data
 // object, returning the output as a string.
-func (t *Template) Execute(text string, data interface{}, logger log.Logger) string {
+func (t *Template) Execute(text string, data interface{}, logger log.Logger) (ret string) {
 	level.Debug(logger).Log("msg", "executing template", "template", text)
-	if !strings.Contains(text, "{{") {
+	if !strings.Contains(text, t.left()) {
 		level.Debug(logger).Log("msg", "  returning unchanged")
 		return text
 	}
@@ -58,19 +240,94 @@ func (t *Template) Execute(text string, data interface{}, logger log.Logger) str
 	if t.err != nil {
 		return ""
 	}
+	defer func() {
+		// A misbehaving template must not take down the process.
+		if r := recover(); r != nil {
+			t.err = fmt.Errorf("template panicked: %v", r)
+			ret = ""
+		}
+		if t.err != nil {
+			level.Warn(logger).Log("msg", "failed to execute template", "template", text, "err", t.err)
+			templateErrorsTotal.WithLabelValues(t.receiver, t.templateName(text)).Inc()
+		} else if strings.Contains(ret, "<no value>") {
+			templateErrorsTotal.WithLabelValues(t.receiver, t.templateName(text)).Inc()
+		}
+	}()
+
 	var tmpl *template.Template
 	tmpl, t.err = t.tmpl.Clone()
 	if t.err != nil {
 		return ""
 	}
+	if t.location != nil {
+		loc := t.location
+		tmpl.Funcs(template.FuncMap{"localTime": func(t time.Time) time.Time { return t.In(loc) }})
+	}
+	labels, annotations := commonKV(data)
+	tmpl.Funcs(template.FuncMap{
+		"annotationOr":  func(key, def string) string { return valueOr(annotations, key, def) },
+		"hasAnnotation": func(key string) bool { return annotations[key] != "" },
+		"labelOr":       func(key, def string) string { return valueOr(labels, key, def) },
+		"hasLabel":      func(key string) bool { return labels[key] != "" },
+	})
 	tmpl, t.err = tmpl.New("").Parse(text)
 	if t.err != nil {
-		level.Warn(logger).Log("msg", "failed to parse template", "template", text)
 		return ""
 	}
 	var buf bytes.Buffer
 	t.err = tmpl.Execute(&buf, data)
-	ret := buf.String()
+	ret = buf.String()
 	level.Debug(logger).Log("msg", "  template output", "output", ret)
 	return ret
 }
+
+// commonKV returns the CommonLabels and CommonAnnotations of data, if it is (or embeds) alertmanager.Data.
+func commonKV(data interface{}) (labels, annotations alertmanager.KV) {
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if v.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	get := func(name string) (kv alertmanager.KV) {
+		defer func() {
+			// FieldByName panics on a nil embedded pointer.
+			if recover() != nil {
+				kv = nil
+			}
+		}()
+		kv, _ = v.FieldByName(name).Interface().(alertmanager.KV)
+		return kv
+	}
+	return get("CommonLabels"), get("CommonAnnotations")
+}
+
+// valueOr returns the value of key in kv, or def if it is missing or empty.
+func valueOr(kv alertmanager.KV, key, def string) string {
+	if v := kv[key]; v != "" {
+		return v
+	}
+	return def
+}
+
+// left returns the left delimiter of t's templates.
+func (t *Template) left() string {
+	if t.leftDelim == "" {
+		return "{{"
+	}
+	return t.leftDelim
+}
+
+// refRE returns the regular expression extracting the names of templates referenced by t's templates.
+func (t *Template) refRE() *regexp.Regexp {
+	if t.leftDelim == "" {
+		return templateRefRE
+	}
+	return regexp.MustCompile(regexp.QuoteMeta(t.leftDelim) + `-?\s*template\s+"([^"]+)"`)
+}
+
+// templateName returns the name of the template block invoked by text, or text itself if it invokes none.
+func (t *Template) templateName(text string) string {
+	if m := t.refRE().FindStringSubmatch(text); m != nil {
+		return m[1]
+	}
+	return text
+}
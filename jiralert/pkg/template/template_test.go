@@ -0,0 +1,148 @@
+package template
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"text/template"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/espekkaya/jiralert-dockerize/jiralert/pkg/alertmanager"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountBy(t *testing.T) {
+	alerts := alertmanager.Alerts{
+		{Labels: alertmanager.KV{"severity": "warning"}},
+		{Labels: alertmanager.KV{"severity": "critical"}},
+		{Labels: alertmanager.KV{"severity": "warning"}},
+		{Labels: alertmanager.KV{}},
+	}
+	require.Equal(t, "1 critical, 2 warning", countBy(alerts, "severity"))
+	require.Equal(t, "", countBy(alerts, "team"))
+}
+
+func TestLoadTemplateReceiverFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_jiralert")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "shared.tmpl"), []byte(`{{ define "summary" }}shared{{ end }}`), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "team.tmpl"), []byte(`{{ define "summary" }}team{{ end }}`), os.ModePerm))
+
+	tmpl, err := LoadTemplate(path.Join(dir, "shared.tmpl"), map[string]string{"team": path.Join(dir, "team.tmpl")}, nil, log.NewNopLogger())
+	require.NoError(t, err)
+
+	logger := log.NewNopLogger()
+	require.Equal(t, "team", tmpl.ForReceiver("team").Execute(`{{ template "summary" }}`, nil, logger))
+	require.Equal(t, "shared", tmpl.ForReceiver("other").Execute(`{{ template "summary" }}`, nil, logger))
+
+	_, err = LoadTemplate(path.Join(dir, "shared.tmpl"), map[string]string{"team": path.Join(dir, "missing.tmpl")}, nil, logger)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `receiver "team"`)
+}
+
+func TestMissingTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_jiralert")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "shared.tmpl"), []byte(`{{ define "jira.summary" }}summary{{ end }}`), os.ModePerm))
+	tmpl, err := LoadTemplate(path.Join(dir, "shared.tmpl"), nil, nil, log.NewNopLogger())
+	require.NoError(t, err)
+
+	require.Empty(t, tmpl.MissingTemplates([]string{`{{ template "jira.summary" . }}`}))
+	require.Equal(t, []string{"jira.descripton"}, tmpl.MissingTemplates([]string{
+		`{{ template "jira.summary" . }}`,
+		`{{- template "jira.descripton" . }} {{ template "jira.descripton" . }}`,
+	}))
+}
+
+func TestAnnotationAndLabelHelpers(t *testing.T) {
+	tmpl := &Template{tmpl: template.New("").Funcs(funcs)}
+	data := &alertmanager.Data{
+		CommonLabels:      alertmanager.KV{"team": "payments"},
+		CommonAnnotations: alertmanager.KV{"runbook_url": "https://runbooks/disk", "summary": ""},
+	}
+	logger := log.NewNopLogger()
+
+	require.Equal(t, "https://runbooks/disk", tmpl.Execute(`{{ annotationOr "runbook_url" "none" }}`, data, logger))
+	require.Equal(t, "none", tmpl.Execute(`{{ annotationOr "summary" "none" }}`, data, logger))
+	require.Equal(t, "yes", tmpl.Execute(`{{ if hasAnnotation "runbook_url" }}yes{{ end }}`, data, logger))
+	require.Equal(t, "payments/unknown", tmpl.Execute(`{{ labelOr "team" "x" }}/{{ labelOr "severity" "unknown" }}`, data, logger))
+	require.Equal(t, "no", tmpl.Execute(`{{ if hasLabel "severity" }}yes{{ else }}no{{ end }}`, data, logger))
+	require.NoError(t, tmpl.Err())
+}
+
+func TestSplit(t *testing.T) {
+	tmpl := &Template{tmpl: template.New("").Funcs(funcs)}
+	require.Equal(t, "db|eu-west", tmpl.Execute(`{{ split "," . | join "|" }}`, " db, ,eu-west ", log.NewNopLogger()))
+	require.NoError(t, tmpl.Err())
+}
+
+func TestEncodingHelpers(t *testing.T) {
+	tmpl := &Template{tmpl: template.New("").Funcs(funcs)}
+	logger := log.NewNopLogger()
+	require.Equal(t, "a%20b%2Fc", tmpl.Execute(`{{ pathEscape . }}`, "a b/c", logger))
+	require.Equal(t, "a+b%2Fc", tmpl.Execute(`{{ urlquery . }}`, "a b/c", logger))
+	require.Equal(t, "aG9zdDo5MTAw", tmpl.Execute(`{{ base64 . }}`, "host:9100", logger))
+	require.NoError(t, tmpl.Err())
+}
+
+func TestStableHash(t *testing.T) {
+	tmpl := &Template{tmpl: template.New("").Funcs(funcs)}
+	logger := log.NewNopLogger()
+	data := &alertmanager.Data{CommonLabels: alertmanager.KV{"alertname": "Down", "cluster": "eu", "instance": "a"}}
+
+	hash := tmpl.Execute(`{{ stableHash .CommonLabels "cluster" "alertname" }}`, data, logger)
+	require.NoError(t, tmpl.Err())
+	require.Len(t, hash, 12)
+	require.Equal(t, hash, stableHash(alertmanager.KV{"alertname": "Down", "cluster": "eu", "instance": "b"}, "alertname", "cluster"))
+	require.NotEqual(t, hash, stableHash(alertmanager.KV{"alertname": "Down", "cluster": "us"}, "alertname", "cluster"))
+}
+
+func TestLoadTemplateReceiverDelims(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_jiralert")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "shared.tmpl"), []byte(`{{ define "summary" }}shared{{ end }}`), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "go.tmpl"), []byte(`[[ define "code" ]]func() {{ x }}[[ end ]]`), os.ModePerm))
+
+	tmpl, err := LoadTemplate(path.Join(dir, "shared.tmpl"), map[string]string{"go": path.Join(dir, "go.tmpl")},
+		map[string][2]string{"go": {"[[", "]]"}}, log.NewNopLogger())
+	require.NoError(t, err)
+
+	logger := log.NewNopLogger()
+	rt := tmpl.ForReceiver("go")
+	require.Equal(t, "func() {{ x }} shared", rt.Execute(`[[ template "code" ]] [[ template "summary" ]]`, nil, logger))
+	require.Equal(t, "{{ literal }}", rt.Execute(`{{ literal }}`, nil, logger))
+	require.NoError(t, rt.Err())
+	require.Equal(t, []string{"details"}, rt.MissingTemplates([]string{`[[ template "code" ]][[ template "details" ]]`}))
+}
+
+func TestLoadTemplateDefaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_jiralert")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	data := &alertmanager.Data{Status: "firing", Alerts: alertmanager.Alerts{{Status: "firing"}}, GroupLabels: alertmanager.KV{"alertname": "Down"}}
+	logger := log.NewNopLogger()
+
+	tmpl, err := LoadTemplate("", nil, nil, logger)
+	require.NoError(t, err)
+	require.Equal(t, "[FIRING:1] Down ", tmpl.Execute(`{{ template "jira.summary" . }}`, data, logger))
+	require.NoError(t, tmpl.Err())
+
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "override.tmpl"), []byte(`{{ define "jira.summary" }}custom{{ end }}`), os.ModePerm))
+	tmpl, err = LoadTemplate(path.Join(dir, "override.tmpl"), nil, nil, logger)
+	require.NoError(t, err)
+	require.Equal(t, "custom", tmpl.Execute(`{{ template "jira.summary" . }}`, data, logger))
+	require.Contains(t, tmpl.Execute(`{{ template "jira.description" . }}`, data, logger), "Labels:")
+	require.NotContains(t, tmpl.Execute(`{{ template "jira.description" . }}`, data, logger), "more")
+	data.TruncatedAlerts = 3
+	require.Contains(t, tmpl.Execute(`{{ template "jira.description" . }}`, data, logger), "...and 3 more\n")
+	require.NoError(t, tmpl.Err())
+}